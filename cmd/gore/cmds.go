@@ -161,4 +161,22 @@ var availableCommands = map[string]command{
 		ofgemFlags,
 		"stationsearch",
 	},
+	"ofgem-options": {
+		"Ofgem Search Options",
+		"Show the parameters and options for an Ofgem command, e.g. ofgem-options stationsearch",
+		formatterRow{
+			[]formatterColumn{},
+		},
+		ofgemFlags,
+		"ofgem-options",
+	},
+	"sync": {
+		"Sync Local Archive",
+		"Update a local SQLite archive with new data for the reports listed",
+		formatterRow{
+			[]formatterColumn{},
+		},
+		syncFlags,
+		"sync",
+	},
 }
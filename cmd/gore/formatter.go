@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/zathras777/gore/pkg/gore"
 )
@@ -19,19 +20,11 @@ type formatterRow struct {
 	columns []formatterColumn
 }
 
-func (fr formatterRow) generateFormat() (fmtString string) {
-	for _, col := range fr.columns {
-		fmtString += col.formatString() + " "
-	}
-	fmtString += "\n"
-	return
-}
-
 func (fr formatterRow) formatTitles() (titleString string) {
 	underscore := ""
 	for _, col := range fr.columns {
 		_fmt := "%"
-		if strings.Contains("stringdatetime", col.format) {
+		if strings.Contains("stringdatetimevalue", col.format) {
 			_fmt += "-"
 		}
 		_fmt += fmt.Sprintf("%ds", col.width)
@@ -43,51 +36,66 @@ func (fr formatterRow) formatTitles() (titleString string) {
 }
 
 func (fr formatterRow) printRows(items []gore.ResultItem) {
-	rowFmt := fr.generateFormat()
 	for _, item := range items {
-		var data []interface{}
-		for _, col := range fr.columns {
-			var dd interface{}
-			switch col.format {
-			case "string":
-				cStr := item.String(col.field)
-				if len(cStr) > col.width {
-					dd = cStr[:col.width-3] + "..."
-				} else {
-					dd = cStr
-				}
-			case "int":
-				dd = item.Int(col.field)
-			case "float":
-				dd = item.Float(col.field)
-			case "bool":
-				if item.Bool(col.field) {
-					dd = "Yes"
-				} else {
-					dd = "No"
-				}
-			case "date":
-				dt := item.Date(col.field)
-				dd = dt.Format("2006-01-02")
-			case "time":
-				dt := item.Date(col.field)
-				dd = dt.Format("15:04")
-			case "datetime":
-				dt := item.Date(col.field)
-				dd = dt.Format("2006-01-02 15:04")
-			default:
-				dd = "?"
+		fr.printItem(item)
+	}
+}
+
+func (fr formatterRow) printItem(item gore.ResultItem) {
+	row := ""
+	for _, col := range fr.columns {
+		if item.IsNull(col.field) {
+			// Null values are shown as an empty cell.
+			row += strings.Repeat(" ", col.width) + " "
+			continue
+		}
+		var dd interface{}
+		switch col.format {
+		case "string":
+			cStr := item.String(col.field)
+			if len(cStr) > col.width {
+				dd = cStr[:col.width-3] + "..."
+			} else {
+				dd = cStr
+			}
+		case "int":
+			dd = item.Int(col.field)
+		case "float":
+			dd = item.Float(col.field)
+		case "bool":
+			if item.Bool(col.field) {
+				dd = "Yes"
+			} else {
+				dd = "No"
 			}
-			data = append(data, dd)
+		case "date":
+			dt := item.Date(col.field)
+			dd = dt.Format("2006-01-02")
+		case "time":
+			dt := item.Date(col.field)
+			dd = dt.Format("15:04")
+		case "datetime":
+			dt := item.Date(col.field)
+			dd = dt.Format("2006-01-02 15:04")
+		case "value":
+			cStr := valueString(item.Data[col.field])
+			if len(cStr) > col.width {
+				dd = cStr[:col.width-3] + "..."
+			} else {
+				dd = cStr
+			}
+		default:
+			dd = "?"
 		}
-		fmt.Printf(rowFmt, data...)
+		row += fmt.Sprintf(col.formatString(), dd) + " "
 	}
+	fmt.Println(row)
 }
 
 func (fc formatterColumn) formatString() (fmtString string) {
 	fmtString = "%"
 	switch fc.format {
-	case "string", "date", "time", "datetime", "bool":
+	case "string", "date", "time", "datetime", "bool", "value":
 		fmtString += fmt.Sprintf("-%ds", fc.width)
 	case "int":
 		fmtString += fmt.Sprintf("%dd", fc.width)
@@ -96,3 +104,32 @@ func (fc formatterColumn) formatString() (fmtString string) {
 	}
 	return
 }
+
+// genericFormatter builds a formatter for results that have no configured
+// columns, showing every field present as text.
+func genericFormatter(rs gore.ResultSet) formatterRow {
+	var fr formatterRow
+	for _, name := range rs.Columns() {
+		width := len(name)
+		for _, item := range rs.Results {
+			if w := len(valueString(item.Data[name])); w > width {
+				width = w
+			}
+		}
+		if width > 30 {
+			width = 30
+		}
+		fr.columns = append(fr.columns, formatterColumn{name, name, "value", width, 0})
+	}
+	return fr
+}
+
+func valueString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return val.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -13,11 +15,13 @@ import (
 	"github.com/zathras777/gore/pkg/elexon"
 	"github.com/zathras777/gore/pkg/gore"
 	"github.com/zathras777/gore/pkg/ofgem"
+	"github.com/zathras777/gore/pkg/store"
 )
 
 var elexonKeyFn string
 var ofgemFlags *flag.FlagSet = flag.NewFlagSet("ofgem", flag.ExitOnError)
 var elexonFlags *flag.FlagSet = flag.NewFlagSet("elexon", flag.ExitOnError)
+var syncFlags *flag.FlagSet = flag.NewFlagSet("sync", flag.ExitOnError)
 var stdFlags *flag.FlagSet = flag.NewFlagSet("common", flag.ExitOnError)
 
 func createTitle(title string) string {
@@ -35,6 +39,8 @@ func showUsage() {
 	ofgemFlags.PrintDefaults()
 	fmt.Println("\nOptions available for Elexon commands:")
 	elexonFlags.PrintDefaults()
+	fmt.Println("\nOptions available for the sync command:")
+	syncFlags.PrintDefaults()
 }
 
 func main() {
@@ -47,33 +53,103 @@ func main() {
 		month         int
 		period        int
 		date          string
+		fromDate      string
+		toDate        string
+		concurrency   int
+		rps           float64
+		elexonURL     string
+		timeout       time.Duration
 		scheme        string
+		toYear        int
+		toMonth       int
+		country       string
+		accreditation string
+		technology    string
+		genType       string
+		certStatus    string
+		holder        string
+		commYear      int
+		commMonth     int
+		organisation  string
+		outputType    string
+		minCapacity   float64
+		maxCapacity   float64
+		ofgemFormat   string
 		name          string
 		bmunit        string
 		xportFormat   string
 		xportFilename string
+		csvDelimiter  string
+		dbFilename    string
+		syncReports   string
+		db            *store.Store
+		captureDir    string
+		streamOutput  bool
+		stream        *gore.ResultStream
+		capture       gore.Capturer
+		cacheDir      string
+		noCache       bool
+		refreshCache  bool
+		cache         gore.Cache
 		err           error
 		cmd           command
 	)
 
 	flag.Usage = showUsage
 
-	ofgemFlags.IntVar(&year, "year", -1, "Specify a year")
-	ofgemFlags.IntVar(&month, "month", -1, "Specify a month")
-	ofgemFlags.StringVar(&scheme, "scheme", "", "Ofgem Scheme (RO, REGO)")
+	ofgemFlags.IntVar(&year, "year", -1, "Specify a year (output period for certificatesearch, accreditation for stationsearch)")
+	ofgemFlags.IntVar(&month, "month", -1, "Specify a month (output period for certificatesearch, accreditation for stationsearch)")
+	ofgemFlags.IntVar(&toYear, "toyear", -1, "Last year of a range of output periods (certificatesearch) (defaults to -year)")
+	ofgemFlags.IntVar(&toMonth, "tomonth", -1, "Last month of a range of output periods (certificatesearch) (defaults to -month)")
+	ofgemFlags.IntVar(&commYear, "commissionyear", -1, "Commission year to search for (stationsearch)")
+	ofgemFlags.IntVar(&commMonth, "commissionmonth", -1, "Commission month to search for (stationsearch)")
+	ofgemFlags.StringVar(&scheme, "scheme", "", "Ofgem Schemes, comma separated (RO, REGO) or * for all")
+	ofgemFlags.StringVar(&country, "country", "", "Countries to search for, comma separated")
+	ofgemFlags.StringVar(&accreditation, "accreditation", "", "Accreditation number (Generator ID) to search for")
+	ofgemFlags.StringVar(&technology, "technology", "", "Technologies to search for, comma separated")
+	ofgemFlags.StringVar(&genType, "generationtype", "", "Generation types to search for, comma separated (certificatesearch)")
+	ofgemFlags.StringVar(&certStatus, "status", "", "Certificate or station statuses to search for, comma separated")
+	ofgemFlags.StringVar(&holder, "holder", "", "Current holder organisation to search for (certificatesearch)")
+	ofgemFlags.StringVar(&organisation, "organisation", "", "Organisation to search for (stationsearch)")
+	ofgemFlags.StringVar(&outputType, "outputtype", "", "Output types to search for, comma separated (stationsearch)")
+	ofgemFlags.Float64Var(&minCapacity, "mincapacity", 0, "Minimum station capacity in kW (stationsearch)")
+	ofgemFlags.Float64Var(&maxCapacity, "maxcapacity", 0, "Maximum station capacity in kW (stationsearch)")
+	ofgemFlags.StringVar(&ofgemFormat, "ofgemformat", "", "Save the report as rendered by Ofgem [CSV, EXCELOPENXML, PDF, WORDOPENXML, ATOM, XML] to -exportfilename")
 
 	elexonFlags.StringVar(&elexonKeyFn, "elexonkey", "elexon.key", "Elexon API Key (required for all Elexon commands)")
 	elexonFlags.StringVar(&bmunit, "bmunit", "", "BMUnit to search for (Elexon or Ofgem)")
 	elexonFlags.StringVar(&date, "date",
 		time.Now().Add(time.Hour*-24).Format("2006-01-02"),
 		"Date to process for (format is YYYY-MM-DD) (defaults to yesterday)")
-	elexonFlags.IntVar(&period, "period", -1, "Settlement Period for Elexon (1-50)")
+	elexonFlags.StringVar(&fromDate, "from", "", "First date of a range to process (format is YYYY-MM-DD)")
+	elexonFlags.StringVar(&toDate, "to", "", "Last date of a range to process (format is YYYY-MM-DD) (defaults to -from)")
+	elexonFlags.StringVar(&elexonURL, "elexonurl", elexon.DefaultBaseURL, "Base URL for the Elexon BMRS API")
+	elexonFlags.DurationVar(&timeout, "timeout", time.Minute, "Timeout for each Elexon request")
+	elexonFlags.IntVar(&concurrency, "concurrency", 4, "Number of concurrent requests when processing a range")
+	elexonFlags.Float64Var(&rps, "rps", 5, "Maximum requests per second when processing a range")
+	elexonFlags.IntVar(&period, "period", -1, "Settlement Period for Elexon (1-46, 1-48 or 1-50 depending on the date)")
 
 	stdFlags.StringVar(&logFn, "log", "gore.log", "Log filename to write to")
 	stdFlags.BoolVar(&verbose, "v", false, "Verbose output (disables logging to a file)")
 	stdFlags.StringVar(&name, "name", "", "Name to search for")
 	stdFlags.StringVar(&xportFormat, "exportformat", "", "Export format [json, xml, csv]")
 	stdFlags.StringVar(&xportFilename, "exportfilename", "", "Filename for exported data")
+	stdFlags.StringVar(&captureDir, "capturedir", "", "Directory to save raw responses into (disabled if not set)")
+	stdFlags.StringVar(&cacheDir, "cachedir", "", "Directory to cache responses in (no caching if not set)")
+	stdFlags.BoolVar(&noCache, "nocache", false, "Do not use or update the response cache")
+	stdFlags.BoolVar(&refreshCache, "refresh", false, "Ignore cached responses, but update the cache with new responses")
+	stdFlags.BoolVar(&streamOutput, "stream", false, "Show and export results as they are received")
+	stdFlags.StringVar(&csvDelimiter, "delimiter", ",", "Field delimiter for CSV exports (use \\t for tab)")
+	stdFlags.StringVar(&dbFilename, "db", "", "SQLite database to save results into (required for sync)")
+
+	syncFlags.StringVar(&syncReports, "reports", "", "Comma separated list of reports to sync, e.g. fuelinst,b1610,certificatesearch")
+	for _, name := range []string{"elexonkey", "from", "elexonurl", "timeout", "concurrency", "rps"} {
+		f := elexonFlags.Lookup(name)
+		syncFlags.Var(f.Value, f.Name, f.Usage)
+	}
+	ofgemFlags.Var(elexonFlags.Lookup("from").Value, "from", "First month of a range of output periods to get month by month (format is YYYY-MM) (certificatesearch)")
+	ofgemFlags.Var(elexonFlags.Lookup("to").Value, "to", "Last month of a range of output periods (format is YYYY-MM) (defaults to -from)")
+	ofgemFlags.Var(elexonFlags.Lookup("concurrency").Value, "concurrency", "Number of months to get at once when processing a range")
 
 	if len(os.Args) < 2 {
 		fmt.Println("At least a command MUST be supplied.")
@@ -110,7 +186,16 @@ func main() {
 	}
 
 	fmt.Printf("Running %s: %s\n", cmd.name, cmd.description)
-	cmd.flags.Parse(os.Args[2:])
+	// Commands such as ofgem-options take arguments, which may be given
+	// before the flags.
+	var cmdArgs []string
+	flagArgs := os.Args[2:]
+	for len(flagArgs) > 0 && !strings.HasPrefix(flagArgs[0], "-") {
+		cmdArgs = append(cmdArgs, flagArgs[0])
+		flagArgs = flagArgs[1:]
+	}
+	cmd.flags.Parse(flagArgs)
+	cmdArgs = append(cmdArgs, cmd.flags.Args()...)
 
 	if verbose {
 		fmt.Println("Logging to command line only. Log file disabled.")
@@ -123,6 +208,53 @@ func main() {
 		log.SetOutput(f)
 	}
 
+	if captureDir != "" {
+		dc, err := gore.NewDirCapturer(captureDir)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		capture = dc
+	}
+	if !noCache && cacheDir != "" {
+		dc, err := gore.NewDirCache(cacheDir)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		dc.Refresh = refreshCache
+		cache = dc
+	}
+
+	if dbFilename != "" {
+		if db, err = store.Open(dbFilename); err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer db.Close()
+	}
+
+	if cmd.reportTag == "sync" {
+		if db == nil {
+			fmt.Println("A database to sync into must be supplied using -db")
+			return
+		}
+		err = runSync(db, syncConfig{syncReports, fromDate, elexonURL, timeout, concurrency, rps, capture, cache})
+		if err != nil {
+			fmt.Printf("Sync failed.\nError: %s\n", err)
+			return
+		}
+		fmt.Println("Sync completed")
+		return
+	}
+
+	if cmd.reportTag == "ofgem-options" {
+		if err := runOfgemOptions(cmdArgs, xportFilename, capture); err != nil {
+			fmt.Printf("Unable to get the options.\nError: %s\n", err)
+		}
+		return
+	}
+
 	params := make(map[string]string)
 	if year != -1 {
 		if year < 100 {
@@ -137,11 +269,32 @@ func main() {
 		}
 		params["Month"] = fmt.Sprintf("%d", month)
 	}
-	if period != -1 {
-		if period < 1 || period > 50 {
-			fmt.Printf("Settlement Period must be between 1 and 50 - not %d\n", period)
+	if toYear != -1 {
+		if toYear < 100 {
+			toYear += 2000
+		}
+		params["YearTo"] = fmt.Sprintf("%d", toYear)
+	}
+	if toMonth != -1 {
+		if toMonth < 1 || toMonth > 12 {
+			fmt.Printf("Month must be between 1 and 12 - not %d\n", toMonth)
 			return
 		}
+		params["MonthTo"] = fmt.Sprintf("%d", toMonth)
+	}
+	if period != -1 {
+		// Periods for a range are checked against each date as it is processed.
+		if fromDate == "" {
+			sd, err := time.Parse("2006-01-02", date)
+			if err != nil {
+				fmt.Printf("Unable to parse date '%s': %s\n", date, err)
+				return
+			}
+			if err := gore.ValidSettlementPeriod(sd, period); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
 		params["Period"] = fmt.Sprintf("%d", period)
 	}
 	if date != "" {
@@ -150,6 +303,42 @@ func main() {
 	if scheme != "" {
 		params["Scheme"] = scheme
 	}
+	if commYear != -1 {
+		if commYear < 100 {
+			commYear += 2000
+		}
+		params["CommissionYear"] = fmt.Sprintf("%d", commYear)
+	}
+	if commMonth != -1 {
+		if commMonth < 1 || commMonth > 12 {
+			fmt.Printf("Month must be between 1 and 12 - not %d\n", commMonth)
+			return
+		}
+		params["CommissionMonth"] = fmt.Sprintf("%d", commMonth)
+	}
+	// A capacity of 0 is valid, so only use those that were given.
+	cmd.flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "mincapacity":
+			params["MinCapacity"] = strconv.FormatFloat(minCapacity, 'f', -1, 64)
+		case "maxcapacity":
+			params["MaxCapacity"] = strconv.FormatFloat(maxCapacity, 'f', -1, 64)
+		}
+	})
+	for k, v := range map[string]string{
+		"Organisation":   organisation,
+		"OutputType":     outputType,
+		"Country":        country,
+		"Accreditation":  accreditation,
+		"Technology":     technology,
+		"GenerationType": genType,
+		"Status":         certStatus,
+		"Holder":         holder,
+	} {
+		if v != "" {
+			params[k] = v
+		}
+	}
 	if name != "" {
 		params["Name"] = name
 	}
@@ -161,31 +350,83 @@ func main() {
 		fmt.Printf("Params for Query: %v\n", params)
 	}
 
+	if ofgemFormat != "" {
+		if err := saveOfgemExport(cmd.reportTag, params, capture, cache, ofgemFormat, xportFilename); err != nil {
+			fmt.Printf("Unable to save the Ofgem export.\nError: %s\n", err)
+		}
+		return
+	}
+
 	var result gore.ResultSet
+	var multi map[string]gore.ResultSet
 	switch cmd.reportTag {
 	case "stationsearch":
-		result, err = doStationSearch(params)
+		if streamOutput {
+			var ss *ofgem.StationSearch
+			if ss, err = newStationSearch(params, capture, cache); err == nil {
+				stream = ss.Stream()
+			}
+			break
+		}
+		result, err = doStationSearch(params, capture, cache)
 	case "certificatesearch":
-		result, err = doCertificateSearch(params)
+		if streamOutput && fromDate == "" {
+			var cs *ofgem.CertificateSearch
+			if cs, err = newCertificateSearch(params, capture, cache); err == nil {
+				stream = cs.Stream()
+			}
+			break
+		}
+		if fromDate != "" {
+			result, err = doCertificateRange(params, fromDate, toDate, concurrency, capture, cache)
+			break
+		}
+		result, err = doCertificateSearch(params, capture, cache)
 	default:
 		var ap *elexon.ElexonAPI
-		ap, err = elexon.NewElexonReport(cmd.reportTag)
+		ap, err = elexon.NewElexonReport(cmd.reportTag, elexon.WithBaseURL(elexonURL), elexon.WithTimeout(timeout), elexon.WithCapture(capture), elexon.WithCache(cache))
 		if err != nil {
 			result = gore.ResultSet{QueryName: cmd.reportTag}
 			break
 		}
 		fmt.Printf("Getting data for Elexon Report %s [ %s ]...\n", ap.Report.Name, ap.Report.Description)
 		err = ap.ReadKeyFile(elexonKeyFn)
-		if err == nil {
+		if err == nil && fromDate != "" {
+			fetcher := elexon.NewFetcher()
+			fetcher.Concurrency = concurrency
+			fetcher.RequestsPerSecond = rps
+			if err = doElexonRange(fetcher, ap, fromDate, toDate, params); err == nil {
+				result = ap.Result
+				if len(ap.Report.Multi) > 0 {
+					multi = ap.MultiResults
+				}
+			}
+		} else if err == nil && streamOutput && len(ap.Report.Multi) == 0 {
+			stream = ap.Stream(context.Background(), params)
+		} else if err == nil {
 			if err = ap.GetData(params); err == nil {
 				result = ap.Result
+				if len(ap.Report.Multi) > 0 {
+					multi = ap.MultiResults
+				}
 			}
 		}
 	}
 
 	if err != nil {
-		fmt.Println(err)
-		result = gore.ResultSet{}
+		fmt.Printf("Unable to complete the requested query.\nError: %s\n", err)
+		switch {
+		case errors.Is(err, gore.ErrAuth):
+			fmt.Println("Check the API key file supplied using -elexonkey is valid.")
+		case errors.Is(err, gore.ErrFormChanged), errors.Is(err, gore.ErrRedirect):
+			fmt.Println("The Ofgem website may have changed and the search needs updating.")
+		}
+		return
+	}
+
+	if stream != nil {
+		runStream(stream, xportFilename, xportFormat, csvDelimiterRune(csvDelimiter), db)
+		return
 	}
 
 	if !result.Query.Completed {
@@ -196,21 +437,44 @@ func main() {
 		fmt.Printf("Query was completed but with an error. No data available.\nError: %s\n", result.Query.Error)
 		return
 	}
-	fmt.Printf("Query succeeded. %d items returned\n", len(result.Results))
+	if multi != nil {
+		fmt.Printf("Query succeeded. %d result sets returned\n", len(multi))
+	} else {
+		fmt.Printf("Query succeeded. %d items returned\n", len(result.Results))
+	}
 	if result.Query.Capped {
-		fmt.Printf("Query response was capped at %d items.\n", result.Query.CapLimit)
+		fmt.Printf("Query response was capped at %d items, the results are incomplete.\n", result.Query.CapLimit)
 	}
 
-	cmd, ck := availableCommands[strings.ToLower(result.QueryName)]
-	if ck && len(cmd.formatter.columns) > 0 {
-		fmt.Println(createTitle(cmd.name + " Output"))
-		fmt.Println(cmd.formatter.formatTitles())
-		cmd.formatter.printRows(result.Results)
+	if multi != nil {
+		printMultiResults(cmd, multi)
+	} else {
+		cmd, ck := availableCommands[strings.ToLower(result.QueryName)]
+		if ck && len(cmd.formatter.columns) > 0 {
+			fmt.Println(createTitle(cmd.name + " Output"))
+			fmt.Println(cmd.formatter.formatTitles())
+			cmd.formatter.printRows(result.Results)
+		}
+	}
+
+	if db != nil {
+		n, err := saveResults(db, result, multi)
+		if err != nil {
+			fmt.Printf("Unable to save results to %s: %s\n", dbFilename, err)
+			return
+		}
+		fmt.Printf("\n %d items saved to %s\n", n, dbFilename)
 	}
 
 	if xportFilename != "" {
 		fmt.Printf("\n Exporting data to %s as %s\n", xportFilename, xportFormat)
-		err = result.Export(xportFilename, xportFormat)
+		if multi != nil {
+			err = gore.ExportMulti(multi, xportFilename, xportFormat, csvDelimiterRune(csvDelimiter))
+		} else if strings.ToLower(xportFormat) == "csv" {
+			err = result.ExportCSV(xportFilename, csvDelimiterRune(csvDelimiter))
+		} else {
+			err = result.Export(xportFilename, xportFormat)
+		}
 		if err != nil {
 			fmt.Println(err)
 			return
@@ -219,6 +483,127 @@ func main() {
 	}
 }
 
+func doElexonRange(fetcher *elexon.Fetcher, ap *elexon.ElexonAPI, fromDate, toDate string, params map[string]string) error {
+	if toDate == "" {
+		toDate = fromDate
+	}
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return fmt.Errorf("Unable to parse from date '%s': %s", fromDate, err)
+	}
+	to, err := time.Parse("2006-01-02", toDate)
+	if err != nil {
+		return fmt.Errorf("Unable to parse to date '%s': %s", toDate, err)
+	}
+	delete(params, "SettlementDate")
+	fmt.Printf("Getting data for %s to %s\n", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	failures, err := fetcher.GetDataRange(context.Background(), ap, from, to, params)
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		fmt.Printf("%d requests failed:\n", len(failures))
+		for _, f := range failures {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+	return nil
+}
+
+func printMultiResults(cmd command, multi map[string]gore.ResultSet) {
+	names := make([]string, 0, len(multi))
+	for name := range multi {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rs := multi[name]
+		fmt.Println(createTitle(fmt.Sprintf("%s Output: %s (%d items)", cmd.name, name, len(rs.Results))))
+		fr := genericFormatter(rs)
+		fmt.Println(fr.formatTitles())
+		fr.printRows(rs.Results)
+	}
+}
+
+// runStream shows and exports the results from the stream as they arrive.
+// If db is not nil the results are saved once the stream is complete.
+func runStream(stream *gore.ResultStream, xportFilename, xportFormat string, delimiter rune, db *store.Store) {
+	var exp gore.Exporter
+	if xportFilename != "" {
+		f, err := os.Create(xportFilename)
+		if err != nil {
+			fmt.Println(err)
+			stream.Close()
+			return
+		}
+		defer f.Close()
+		if exp, err = gore.NewExporter(f, xportFormat, stream.Schema, delimiter); err != nil {
+			fmt.Println(err)
+			stream.Close()
+			return
+		}
+		fmt.Printf("Exporting data to %s as %s as it is received\n", xportFilename, xportFormat)
+	}
+
+	cmd, ck := availableCommands[strings.ToLower(stream.QueryName)]
+	show := ck && len(cmd.formatter.columns) > 0
+	if show {
+		fmt.Println(createTitle(cmd.name + " Output"))
+		fmt.Println(cmd.formatter.formatTitles())
+	}
+	saved := gore.ResultSet{QueryName: stream.QueryName, Schema: stream.Schema}
+	count := 0
+	for stream.Next() {
+		item := stream.Item()
+		count++
+		if db != nil {
+			saved.Results = append(saved.Results, item)
+		}
+		if show {
+			cmd.formatter.printItem(item)
+		}
+		if exp != nil {
+			if err := exp.Write(item); err != nil {
+				fmt.Printf("Export failed: %s\n", err)
+				stream.Close()
+				return
+			}
+		}
+	}
+	if exp != nil {
+		if err := exp.Close(); err != nil {
+			fmt.Printf("Export failed: %s\n", err)
+		}
+	}
+
+	qr := stream.Query()
+	if qr.Error != nil {
+		fmt.Printf("\nQuery failed after %d items.\nError: %s\n", count, qr.Error)
+		return
+	}
+	fmt.Printf("\nQuery succeeded. %d items returned\n", count)
+	if qr.Capped {
+		fmt.Printf("Query response was capped at %d items.\n", qr.CapLimit)
+	}
+	if db != nil {
+		if _, err := db.Save(saved); err != nil {
+			fmt.Printf("Unable to save results: %s\n", err)
+			return
+		}
+		fmt.Printf("%d items saved\n", count)
+	}
+}
+
+func csvDelimiterRune(delim string) rune {
+	if delim == "\\t" || delim == "tab" {
+		return '\t'
+	}
+	if len(delim) == 0 {
+		return ','
+	}
+	return []rune(delim)[0]
+}
+
 func printAvailableCommands() {
 	fmt.Printf("\n%s", createTitle("Available Commands"))
 	cmds := make([]string, 0, len(availableCommands))
@@ -234,67 +619,275 @@ func printAvailableCommands() {
 	fmt.Println()
 }
 
-func doCertificateSearch(params map[string]string) (gore.ResultSet, error) {
-	cs := ofgem.NewCertificateSearch()
-	year, ck := params["Year"]
-	if ck {
-		num, err := strconv.Atoi(year)
+func doCertificateSearch(params map[string]string, capture gore.Capturer, cache gore.Cache) (gore.ResultSet, error) {
+	cs, err := newCertificateSearch(params, capture, cache)
+	if err != nil {
+		return gore.ResultSet{}, err
+	}
+	return checkPartial(cs.GetAllResults())
+}
+
+// saveOfgemExport saves the search as rendered by Ofgem in the format xfmt.
+// If no filename is given the report tag and usual extension are used.
+func saveOfgemExport(reportTag string, params map[string]string, capture gore.Capturer, cache gore.Cache, xfmt, filename string) error {
+	xfmt, ext, err := ofgem.ExportFormat(xfmt)
+	if err != nil {
+		return err
+	}
+	var report *ofgem.Report
+	switch reportTag {
+	case "certificatesearch":
+		cs, err := newCertificateSearch(params, capture, cache)
 		if err != nil {
-			return gore.ResultSet{}, nil
+			return err
 		}
-		if err := cs.SetYear(num); err != nil {
-			return gore.ResultSet{}, err
+		report = cs.Report
+	case "stationsearch":
+		ss, err := newStationSearch(params, capture, cache)
+		if err != nil {
+			return err
 		}
+		report = ss.Report
+	default:
+		return fmt.Errorf("-ofgemformat is only available for the Ofgem searches")
+	}
+	if filename == "" {
+		filename = reportTag + ext
+	}
+	n, err := report.SaveExport(filename, xfmt)
+	if err != nil {
+		return err
 	}
-	month, ck := params["Month"]
-	if ck {
-		num, err := strconv.Atoi(month)
+	fmt.Printf("Saved %d bytes of %s to %s\n", n, xfmt, filename)
+	return nil
+}
+
+// ofgemClient is shared by all the Ofgem searches, so commands that make
+// several searches, such as sync, only start one session.
+var ofgemClient *ofgem.Client
+
+func ofgemSession() (*ofgem.Client, error) {
+	if ofgemClient == nil {
+		client, err := ofgem.NewClient()
 		if err != nil {
-			return gore.ResultSet{}, nil
-		}
-		if err := cs.SetMonth(num); err != nil {
-			return gore.ResultSet{}, err
+			return nil, err
 		}
+		ofgemClient = client
 	}
-	result := cs.GetResults()
-	if result.Query.Error != nil {
+	return ofgemClient, nil
+}
+
+// checkPartial returns the error for an Ofgem search unless some results
+// were found, when a warning is shown and the incomplete results returned.
+func checkPartial(result gore.ResultSet) (gore.ResultSet, error) {
+	if result.Query.Error == nil {
+		return result, nil
+	}
+	if !result.Query.Capped {
 		return result, result.Query.Error
 	}
+	fmt.Printf("Some results could not be retrieved.\nError: %s\n", result.Query.Error)
+	result.Query.Error = nil
 	return result, nil
 }
 
-func doStationSearch(params map[string]string) (gore.ResultSet, error) {
-	ss := ofgem.NewStationSearch()
-	year, ck := params["Year"]
-	if ck {
-		num, err := strconv.Atoi(year)
-		if err != nil {
-			return gore.ResultSet{}, nil
-		}
-		if err := ss.AccreditationYear(num); err != nil {
-			return gore.ResultSet{}, err
-		}
+func newCertificateSearch(params map[string]string, capture gore.Capturer, cache gore.Cache) (*ofgem.CertificateSearch, error) {
+	client, err := ofgemSession()
+	if err != nil {
+		return nil, err
 	}
-	month, ck := params["Month"]
-	if ck {
-		num, err := strconv.Atoi(month)
-		if err != nil {
-			return gore.ResultSet{}, nil
+	cs, err := client.NewCertificateSearch()
+	if err != nil {
+		return nil, err
+	}
+	cs.SetCapture(capture)
+	cs.SetCache(cache)
+	if err := setCertificateFilters(cs, params); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// setCertificateFilters sets the output period and filters of cs from the
+// params.
+func setCertificateFilters(cs *ofgem.CertificateSearch, params map[string]string) error {
+	// The end of the output period range defaults to the start.
+	for _, period := range []struct {
+		param, toParam string
+		from, to       func(int) error
+	}{
+		{"Year", "YearTo", cs.SetYearFrom, cs.SetYearTo},
+		{"Month", "MonthTo", cs.SetMonthFrom, cs.SetMonthTo},
+	} {
+		from, ck := params[period.param]
+		if ck {
+			num, err := strconv.Atoi(from)
+			if err != nil {
+				return err
+			}
+			if err := period.from(num); err != nil {
+				return err
+			}
+		}
+		if to, ck := params[period.toParam]; ck {
+			from = to
 		}
-		if err := ss.AccreditationMonth(num); err != nil {
-			return gore.ResultSet{}, err
+		if from != "" {
+			num, err := strconv.Atoi(from)
+			if err != nil {
+				return err
+			}
+			if err := period.to(num); err != nil {
+				return err
+			}
 		}
 	}
-	sch, ck := params["Scheme"]
-	if ck {
-		if err := ss.Scheme(sch); err != nil {
-			return gore.ResultSet{}, err
+
+	for _, filter := range []struct {
+		param string
+		set   func(string) error
+	}{
+		{"Scheme", cs.Scheme},
+		{"Country", cs.Countries},
+		{"Accreditation", cs.AccreditationNumber},
+		{"Name", cs.StationName},
+		{"Technology", cs.TechnologyGroups},
+		{"GenerationType", cs.GenerationTypes},
+		{"Status", cs.CertificateStatus},
+		{"Holder", cs.CurrentHolder},
+	} {
+		if val, ck := params[filter.param]; ck {
+			if err := filter.set(val); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
 
-	result := ss.GetResults()
+// doCertificateRange gets the certificates for each month from fromDate to
+// toDate, searching several months at once.
+func doCertificateRange(params map[string]string, fromDate, toDate string, concurrency int, capture gore.Capturer, cache gore.Cache) (gore.ResultSet, error) {
+	if toDate == "" {
+		toDate = fromDate
+	}
+	from, err := parseMonth(fromDate)
+	if err != nil {
+		return gore.ResultSet{}, err
+	}
+	to, err := parseMonth(toDate)
+	if err != nil {
+		return gore.ResultSet{}, err
+	}
+	// The output period is set for each month.
+	for _, p := range []string{"Year", "Month", "YearTo", "MonthTo"} {
+		delete(params, p)
+	}
+	fmt.Printf("Getting certificates for %s to %s\n", from.Format("Jan-2006"), to.Format("Jan-2006"))
+	download := ofgem.CertificateDownload{
+		Concurrency: concurrency,
+		Filter: func(cs *ofgem.CertificateSearch) error {
+			return setCertificateFilters(cs, params)
+		},
+		Capture: capture,
+		Cache:   cache,
+	}
+	result, failures := download.GetMonths(context.Background(), from, to)
 	if result.Query.Error != nil {
 		return result, result.Query.Error
 	}
+	for _, failure := range failures {
+		fmt.Printf("Unable to get all the certificates for %s\n", failure)
+	}
 	return result, nil
 }
+
+// parseMonth accepts a month as YYYY-MM or a date as YYYY-MM-DD.
+func parseMonth(month string) (time.Time, error) {
+	for _, layout := range []string{"2006-01", "2006-01-02"} {
+		if dt, err := time.Parse(layout, month); err == nil {
+			return dt, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Unable to parse month '%s', expected YYYY-MM", month)
+}
+
+func doStationSearch(params map[string]string, capture gore.Capturer, cache gore.Cache) (gore.ResultSet, error) {
+	ss, err := newStationSearch(params, capture, cache)
+	if err != nil {
+		return gore.ResultSet{}, err
+	}
+	return checkPartial(ss.GetAllResults())
+}
+
+func newStationSearch(params map[string]string, capture gore.Capturer, cache gore.Cache) (*ofgem.StationSearch, error) {
+	client, err := ofgemSession()
+	if err != nil {
+		return nil, err
+	}
+	ss, err := client.NewStationSearch()
+	if err != nil {
+		return nil, err
+	}
+	ss.SetCapture(capture)
+	ss.SetCache(cache)
+
+	for _, filter := range []struct {
+		param string
+		set   func(int) error
+	}{
+		{"Year", ss.AccreditationYear},
+		{"Month", ss.AccreditationMonth},
+		{"CommissionYear", ss.CommissionYear},
+		{"CommissionMonth", ss.CommissionMonth},
+	} {
+		if val, ck := params[filter.param]; ck {
+			num, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, err
+			}
+			if err := filter.set(num); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, filter := range []struct {
+		param string
+		set   func(string) error
+	}{
+		{"Scheme", ss.Scheme},
+		{"Name", ss.GeneratorName},
+		{"Accreditation", ss.GeneratorID},
+		{"Technology", ss.Technologies},
+		{"Country", ss.Countries},
+		{"Status", ss.Statuses},
+		{"Organisation", ss.Organisation},
+		{"OutputType", ss.OutputTypes},
+	} {
+		if val, ck := params[filter.param]; ck {
+			if err := filter.set(val); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, filter := range []struct {
+		param string
+		set   func(float64) error
+	}{
+		{"MinCapacity", ss.MinCapacity},
+		{"MaxCapacity", ss.MaxCapacity},
+	} {
+		if val, ck := params[filter.param]; ck {
+			num, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, err
+			}
+			if err := filter.set(num); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ss, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zathras777/gore/pkg/gore"
+	"github.com/zathras777/gore/pkg/ofgem"
+)
+
+// ofgemParameters opens the search for the named command and returns its
+// parameters.
+func ofgemParameters(name string, capture gore.Capturer) ([]ofgem.Parameter, error) {
+	switch strings.ToLower(name) {
+	case "certificatesearch":
+		cs, err := newCertificateSearch(map[string]string{}, capture, nil)
+		if err != nil {
+			return nil, err
+		}
+		return cs.Parameters(), nil
+	case "stationsearch":
+		ss, err := newStationSearch(map[string]string{}, capture, nil)
+		if err != nil {
+			return nil, err
+		}
+		return ss.Parameters(), nil
+	}
+	return nil, fmt.Errorf("Unknown Ofgem command '%s', expected certificatesearch or stationsearch", name)
+}
+
+// runOfgemOptions shows the parameters and options available for an Ofgem
+// command, or writes them to xportFilename as JSON.
+func runOfgemOptions(args []string, xportFilename string, capture gore.Capturer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("The Ofgem command to show options for must be given, e.g. ofgem-options certificatesearch")
+	}
+	params, err := ofgemParameters(args[0], capture)
+	if err != nil {
+		return err
+	}
+	if xportFilename != "" {
+		content, err := json.MarshalIndent(params, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Writing parameters to %s\n", xportFilename)
+		return os.WriteFile(xportFilename, content, 0644)
+	}
+
+	fmt.Println(createTitle("Parameters for " + args[0]))
+	for _, p := range params {
+		postback := ""
+		if p.Postback {
+			postback = " (changing this updates the form)"
+		}
+		fmt.Printf("%s [%s]%s\n", p.Label, p.Kind, postback)
+		fmt.Printf("    Current value: %s\n", p.Value)
+		if len(p.Options) > 0 {
+			fmt.Println("    Options:")
+			for _, opt := range p.Options {
+				fmt.Printf("      %s\n", opt)
+			}
+		}
+	}
+	return nil
+}
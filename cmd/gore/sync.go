@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zathras777/gore/pkg/elexon"
+	"github.com/zathras777/gore/pkg/gore"
+	"github.com/zathras777/gore/pkg/store"
+)
+
+// syncDays is the number of days fetched before the results are saved and
+// the sync state updated.
+const syncDays = 7
+
+type syncConfig struct {
+	reports     string
+	from        string
+	elexonURL   string
+	timeout     time.Duration
+	concurrency int
+	rps         float64
+	capture     gore.Capturer
+	cache       gore.Cache
+}
+
+// saveResults saves the result, or each of the multi results, to the
+// database. Multi results are saved into a table per record type.
+func saveResults(db *store.Store, result gore.ResultSet, multi map[string]gore.ResultSet) (int, error) {
+	if multi == nil {
+		return db.Save(result)
+	}
+	total := 0
+	for block, rs := range multi {
+		n, err := db.SaveTable(multiTableName(result.QueryName, block), rs)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func multiTableName(queryName, block string) string {
+	return store.TableName(queryName + "_" + block)
+}
+
+// runSync brings the archive in db up to date for each of the reports. Elexon
+// reports are fetched from the day after the last date saved, or cfg.from
+// for a report not yet in the archive, until yesterday.
+func runSync(db *store.Store, cfg syncConfig) error {
+	if cfg.reports == "" {
+		return fmt.Errorf("The reports to sync must be supplied using -reports")
+	}
+	yesterday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	for _, report := range strings.Split(cfg.reports, ",") {
+		report = strings.ToLower(strings.TrimSpace(report))
+		if report == "" {
+			continue
+		}
+		var err error
+		switch report {
+		case "certificatesearch":
+			err = syncCertificates(db, cfg, yesterday)
+		case "stationsearch":
+			err = syncStations(db, cfg, yesterday)
+		default:
+			err = syncElexon(db, cfg, report, yesterday)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to sync %s: %w", report, err)
+		}
+	}
+	return nil
+}
+
+// syncStart returns the last date synced for name, or the from date if
+// name has not been synced before. The bool is true for a previous sync.
+func syncStart(db *store.Store, name, from, layout string) (time.Time, bool, error) {
+	last, ck, err := db.SyncState(name)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if ck {
+		sd, err := time.Parse(layout, last)
+		return sd, true, err
+	}
+	if from == "" {
+		return time.Time{}, false, fmt.Errorf("%s has not been synced before so -from must be supplied", name)
+	}
+	sd, err := time.Parse("2006-01-02", from)
+	return sd, false, err
+}
+
+func syncElexon(db *store.Store, cfg syncConfig, report string, yesterday time.Time) error {
+	ap, err := elexon.NewElexonReport(report, elexon.WithBaseURL(cfg.elexonURL), elexon.WithTimeout(cfg.timeout), elexon.WithCapture(cfg.capture), elexon.WithCache(cfg.cache))
+	if err != nil {
+		return err
+	}
+	for _, rqd := range ap.Report.RqdParams {
+		if rqd != "SettlementDate" && rqd != "Period" {
+			return fmt.Errorf("Report %s requires the %s parameter so cannot be synced by date", ap.Report.Name, rqd)
+		}
+	}
+	if err := ap.ReadKeyFile(elexonKeyFn); err != nil {
+		return err
+	}
+
+	name := store.TableName(ap.Report.Name)
+	from, synced, err := syncStart(db, name, cfg.from, "2006-01-02")
+	if err != nil {
+		return err
+	}
+	if synced {
+		from = from.AddDate(0, 0, 1)
+	}
+	if from.After(yesterday) {
+		fmt.Printf("%s is up to date\n", ap.Report.Name)
+		return nil
+	}
+
+	fetcher := elexon.NewFetcher()
+	fetcher.Concurrency = cfg.concurrency
+	fetcher.RequestsPerSecond = cfg.rps
+	for start := from; !start.After(yesterday); start = start.AddDate(0, 0, syncDays) {
+		end := start.AddDate(0, 0, syncDays-1)
+		if end.After(yesterday) {
+			end = yesterday
+		}
+		fmt.Printf("Syncing %s for %s to %s\n", ap.Report.Name, start.Format("2006-01-02"), end.Format("2006-01-02"))
+		failures, err := fetcher.GetDataRange(context.Background(), ap, start, end, map[string]string{})
+		if err != nil {
+			return err
+		}
+		var multi map[string]gore.ResultSet
+		if len(ap.Report.Multi) > 0 {
+			multi = ap.MultiResults
+		}
+		n, err := saveResults(db, ap.Result, multi)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  %d items saved\n", n)
+
+		// Only record the dates before the first failure so the rest are
+		// requested again next time.
+		done := end
+		if len(failures) > 0 {
+			sort.Slice(failures, func(i, j int) bool { return failures[i].SettlementDate.Before(failures[j].SettlementDate) })
+			done = failures[0].SettlementDate.AddDate(0, 0, -1)
+		}
+		if !done.Before(start) {
+			if err := db.SetSyncState(name, done.Format("2006-01-02")); err != nil {
+				return err
+			}
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("%d requests failed, the first was %w", len(failures), failures[0])
+		}
+	}
+	return nil
+}
+
+// syncCertificates fetches certificates month by month. The last month
+// synced is always fetched again as certificates are issued for some time
+// after the month ends.
+func syncCertificates(db *store.Store, cfg syncConfig, yesterday time.Time) error {
+	const name = "certificatesearch"
+	from, _, err := syncStart(db, name, cfg.from, "2006-01")
+	if err != nil {
+		return err
+	}
+	for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(yesterday); month = month.AddDate(0, 1, 0) {
+		fmt.Printf("Syncing certificates for %s\n", month.Format("January 2006"))
+		cs, err := newCertificateSearch(map[string]string{}, cfg.capture, cfg.cache)
+		if err != nil {
+			return err
+		}
+		if err := cs.SetPeriod(int(month.Month()), month.Year()); err != nil {
+			return err
+		}
+		result := cs.GetAllResults()
+		if result.Query.Error != nil && !result.Query.Capped {
+			return result.Query.Error
+		}
+		n, err := db.Save(result)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  %d items saved\n", n)
+		if result.Query.Capped {
+			// Save what was found, but fetch the month again next time.
+			return fmt.Errorf("Certificates for %s are incomplete: %w", month.Format("January 2006"), result.Query.Err())
+		}
+		if err := db.SetSyncState(name, month.Format("2006-01")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncStations fetches the complete list of stations the first time it is
+// synced. After that only the stations accredited since the last month
+// synced are fetched, with that month fetched again as stations can be
+// added to it for a while after it ends.
+func syncStations(db *store.Store, cfg syncConfig, yesterday time.Time) error {
+	const name = "stationsearch"
+	last, synced, err := db.SyncState(name)
+	if err != nil {
+		return err
+	}
+	if !synced {
+		fmt.Println("Syncing all stations")
+		if err := saveStations(db, cfg, map[string]string{}, "The station list"); err != nil {
+			return err
+		}
+		return db.SetSyncState(name, yesterday.Format("2006-01"))
+	}
+	from, err := time.Parse("2006-01", last)
+	if err != nil {
+		return err
+	}
+	for month := from; !month.After(yesterday); month = month.AddDate(0, 1, 0) {
+		fmt.Printf("Syncing stations accredited in %s\n", month.Format("January 2006"))
+		params := map[string]string{
+			"Year":  strconv.Itoa(month.Year()),
+			"Month": strconv.Itoa(int(month.Month())),
+		}
+		if err := saveStations(db, cfg, params, "Stations for "+month.Format("January 2006")); err != nil {
+			return err
+		}
+		if err := db.SetSyncState(name, month.Format("2006-01")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveStations saves the stations found by a search using params. Partial
+// results are saved, but an error using desc is returned.
+func saveStations(db *store.Store, cfg syncConfig, params map[string]string, desc string) error {
+	ss, err := newStationSearch(params, cfg.capture, cfg.cache)
+	if err != nil {
+		return err
+	}
+	result := ss.GetAllResults()
+	if result.Query.Error != nil && !result.Query.Capped {
+		return result.Query.Error
+	}
+	n, err := db.Save(result)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  %d items saved\n", n)
+	if result.Query.Capped {
+		return fmt.Errorf("%s is incomplete: %w", desc, result.Query.Err())
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ go 1.18
 
 require (
 	github.com/PuerkitoBio/goquery v1.5.1
+	github.com/mattn/go-sqlite3 v1.14.16
 	golang.org/x/net v0.0.0-20200602114024-627f9648deb9
 )
 
@@ -1,12 +1,17 @@
 package elexon
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zathras777/gore/pkg/gore"
 )
@@ -17,6 +22,7 @@ type ElexonAPI struct {
 	MultiResults map[string]gore.ResultSet
 
 	key string
+	cfg apiConfig
 }
 
 var metadataMap = map[string]string{
@@ -28,16 +34,30 @@ var metadataMap = map[string]string{
 	"queryString":    "string",
 }
 
-func NewElexonReport(report string) (*ElexonAPI, error) {
+func NewElexonReport(report string, opts ...Option) (*ElexonAPI, error) {
 	cfg, ck := ElexonReports[strings.ToLower(report)]
 	if !ck {
 		return nil, fmt.Errorf("Unable to find a configured report %s", report)
 	}
-	ap := ElexonAPI{Report: cfg}
+	ap := ElexonAPI{Report: cfg, cfg: newAPIConfig(opts)}
 	ap.Result.QueryName = ap.Report.Name
+	ap.Result.Schema = ap.schema("")
 	return &ap, nil
 }
 
+// schema returns the Schema for the report, or for one block of a multi
+// block report.
+func (ap *ElexonAPI) schema(block string) gore.Schema {
+	schema := gore.NewSchema(ap.Report.fields(block))
+	if _, ck := schema.Field("settlementPeriod"); ck {
+		schema = schema.Add(gore.Field{Name: "settlementTime", Type: "dateTime", Nullable: true})
+	}
+	if keys, ck := blockKeys[ap.Report.Name][block]; ck {
+		return schema.WithKey(keys...)
+	}
+	return schema.WithKey(reportKeys[ap.Report.Name]...)
+}
+
 func (ap *ElexonAPI) ReadKeyFile(keyFn string) error {
 	content, err := ioutil.ReadFile(keyFn)
 	if err != nil {
@@ -48,11 +68,64 @@ func (ap *ElexonAPI) ReadKeyFile(keyFn string) error {
 	return nil
 }
 
+var errEmptyResponse = fmt.Errorf("%w receieved from Elexon", gore.ErrEmpty)
+
 func (ap *ElexonAPI) GetData(args map[string]string) error {
+	return ap.GetDataContext(context.Background(), args)
+}
+
+// GetDataContext is the same as GetData, but the request is cancelled if the
+// context is done before it completes.
+func (ap *ElexonAPI) GetDataContext(ctx context.Context, args map[string]string) error {
+	multi := len(ap.Report.Multi) != 0
+	if multi {
+		ap.MultiResults = make(map[string]gore.ResultSet)
+	}
+	qr, err := ap.StreamData(ctx, args, func(item gore.ResultItem) error {
+		if !multi {
+			ap.Result.Results = append(ap.Result.Results, item)
+			return nil
+		}
+		block := item.String("recordType")
+		if len(block) == 0 {
+			block = "UNKNOWN"
+		}
+		rs, ck := ap.MultiResults[block]
+		if !ck {
+			rs = gore.ResultSet{QueryName: block, Schema: ap.schema(block)}
+		}
+		rs.Results = append(rs.Results, item)
+		ap.MultiResults[block] = rs
+		return nil
+	})
+	if qr.Completed {
+		ap.Result.Query = qr
+		for block, rs := range ap.MultiResults {
+			rs.Query = qr
+			ap.MultiResults[block] = rs
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if multi {
+		for block, rs := range ap.MultiResults {
+			log.Printf("%s API call returned %d %s items", ap.Report.Name, len(rs.Results), block)
+		}
+	} else {
+		log.Printf("%s API call returned %d items", ap.Report.Name, len(ap.Result.Results))
+	}
+	return nil
+}
+
+// StreamData makes a request and passes each item to fn as it is decoded
+// from the response, rather than storing them in ap.Result. Any error
+// returned by fn stops processing and is returned.
+func (ap *ElexonAPI) StreamData(ctx context.Context, args map[string]string, fn func(gore.ResultItem) error) (qr gore.QueryResult, err error) {
 	params := url.Values{}
 	_, ck := args["APIKey"]
 	if !ck && len(ap.key) == 0 {
-		return fmt.Errorf("You either need to supply the APIKey parameter or call ReadKeyFile() before getting data")
+		return qr, fmt.Errorf("You either need to supply the APIKey parameter or call ReadKeyFile() before getting data: %w", gore.ErrAuth)
 	}
 	if !ck {
 		params.Add("APIKey", ap.key)
@@ -62,7 +135,7 @@ func (ap *ElexonAPI) GetData(args map[string]string) error {
 	for _, rqd := range ap.Report.RqdParams {
 		_, ck := args[rqd]
 		if !ck {
-			return fmt.Errorf("Calls to Report %s require the %s parameter to be set", ap.Report.Name, rqd)
+			return qr, fmt.Errorf("Calls to Report %s require the %s parameter to be set", ap.Report.Name, rqd)
 		}
 	}
 	for k, v := range args {
@@ -72,90 +145,233 @@ func (ap *ElexonAPI) GetData(args map[string]string) error {
 		ap.Report.updateParams(params)
 	}
 
-	url := fmt.Sprintf("https://api.bmreports.com/BMRS/%s/%s?%s", ap.Report.Name, ap.Report.Version, params.Encode())
-	resp, err := http.Get(url)
+	// An ElexonAPI created without NewElexonReport has no defaults set. They
+	// are not stored, as requests may be made from several goroutines.
+	client, baseURL := ap.cfg.client, ap.cfg.baseURL
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if ap.cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ap.cfg.timeout)
+		defer cancel()
+	}
+	key := ap.cacheKey(params)
+	if ap.cfg.cache != nil {
+		if rdr, ck := gore.OpenCached(ap.cfg.cache, key, ap.cacheTTL(args)); ck {
+			defer rdr.Close()
+			log.Printf("%s response read from cache", ap.Report.Name)
+			return ap.processResponse(rdr, fn)
+		}
+	}
+
+	url := fmt.Sprintf("%s%s/%s?%s", baseURL, ap.Report.Name, ap.Report.Version, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return err
+		return qr, err
 	}
-	if resp.StatusCode != 200 {
-		fmt.Println(resp)
-		return fmt.Errorf("Elexon server responded with a status code %d. Url was %s", resp.StatusCode, url)
+	if len(ap.cfg.userAgent) > 0 {
+		req.Header.Set("User-Agent", ap.cfg.userAgent)
 	}
-	content, err := ioutil.ReadAll(resp.Body)
+	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("%s API call FAILED: %s", ap.Report.Name, err)
-		return err
+		return qr, err
 	}
-	if len(content) == 0 {
-		log.Printf("Empty response received. Status Code %d\n\n", resp.StatusCode)
-		fmt.Println(resp)
-		return fmt.Errorf("Empty response receieved from Elexon")
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return qr, &gore.HTTPError{StatusCode: resp.StatusCode, URL: url}
 	}
 
-	ioutil.WriteFile(fmt.Sprintf("%s.xml", ap.Report.Name), content, 0644)
-
-	xmlN, err := gore.ParseXML(content)
-	if err != nil {
-		return err
+	// Responses can be large, so any copy needed for the capture or cache is
+	// kept in a temporary file rather than in memory.
+	var body io.Reader = resp.Body
+	var spool *gore.Spool
+	if ap.cfg.capture != nil || ap.cfg.cache != nil {
+		spool, err = gore.NewSpool()
+		if err != nil {
+			return qr, err
+		}
+		defer spool.Close()
+		body = io.TeeReader(body, spool)
+	}
+	count := 0
+	qr, err = ap.processResponse(body, func(item gore.ResultItem) error {
+		count++
+		return fn(item)
+	})
+	if ap.cfg.capture != nil {
+		if err := spool.Capture(ap.cfg.capture, ap.Report.Name); err != nil {
+			log.Printf("Unable to capture %s response: %s", ap.Report.Name, err)
+		}
+	}
+	// Capped and empty responses may be complete when requested again, so
+	// only complete responses with some data are cached.
+	if err == nil && ap.cfg.cache != nil && qr.Completed && !qr.Capped && !qr.Empty && count > 0 {
+		if err := spool.Cache(ap.cfg.cache, key); err != nil {
+			log.Printf("Unable to cache %s response: %s", ap.Report.Name, err)
+		}
 	}
+	return qr, err
+}
+
+// processResponse decodes the XML response in body, passing each item to fn.
+func (ap *ElexonAPI) processResponse(body io.Reader, fn func(gore.ResultItem) error) (qr gore.QueryResult, err error) {
 	// Regardless of whether there is a multi dataset response or not, the results of the query
-	// are only sent once. Read them here and create a gore.QueryResult that we can use for subsequent
-	// gore.ReultSet creation.
-	qr := queryResultFromResponse(xmlN)
-	if qr.Error != nil {
-		ap.Result.Query = qr
-		return err
+	// are only sent once and before any items, so we can check them before processing the items.
+	gotMetadata := false
+	stream := gore.NewXMLStream(body)
+	stream.Handle("responseMetadata", func(node gore.XmlNode) error {
+		gotMetadata = true
+		qr = queryResultFromMetadata(node)
+		return qr.Error
+	})
+	stream.Handle("responseBody.responseList.item", func(node gore.XmlNode) error {
+		if !gotMetadata {
+			return fmt.Errorf("%w: Items received before the response metadata", gore.ErrParse)
+		}
+		return fn(gore.ResultItem{Data: ap.itemMap(node)})
+	})
+	if err := stream.Run(); err != nil {
+		if errors.Is(err, gore.ErrEmpty) {
+			log.Printf("Empty response received for %s\n\n", ap.Report.Name)
+			return qr, errEmptyResponse
+		}
+		log.Printf("%s API call FAILED: %s", ap.Report.Name, err)
+		return qr, err
+	}
+	if !gotMetadata {
+		qr.Error = fmt.Errorf("%w: Unable to find a node matching 'responseMetadata'", gore.ErrParse)
+		return qr, qr.Error
 	}
+	return qr, nil
+}
 
-	if len(ap.Report.Multi) == 0 {
-		ap.Result.Query = qr
-		if qr.Empty {
-			return nil
+// cacheKey identifies a request by the report and parameters, excluding
+// the APIKey so that responses can be shared between keys.
+func (ap *ElexonAPI) cacheKey(params url.Values) string {
+	keyParams := url.Values{}
+	for k, v := range params {
+		if k != "APIKey" {
+			keyParams[k] = v
 		}
+	}
+	return fmt.Sprintf("elexon/%s/%s?%s", ap.Report.Name, ap.Report.Version, keyParams.Encode())
+}
 
-		items, err := xmlN.GetAll("responseBody.responseList.item")
+// cacheTTL returns how long a response for args can be cached, based on the
+// last date the request covers.
+func (ap *ElexonAPI) cacheTTL(args map[string]string) time.Duration {
+	ttl, ck := reportCacheTTL[ap.Report.Name]
+	if !ck {
+		ttl = gore.DefaultCacheTTL
+	}
+	var last time.Time
+	if sd, err := time.Parse("2006-01-02", args["SettlementDate"]); err == nil {
+		last = sd
+	} else if year, err := strconv.Atoi(args["Year"]); err == nil {
+		last = time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+		if month, err := strconv.Atoi(args["Month"]); err == nil {
+			last = time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC)
+		}
+	}
+	return ttl.For(last)
+}
+
+// Stream makes a request and returns a stream of the items as they are
+// decoded from the response. Reports with multiple blocks return the items
+// from all blocks, which can be told apart using their recordType.
+func (ap *ElexonAPI) Stream(ctx context.Context, args map[string]string) *gore.ResultStream {
+	return gore.NewResultStream(ap.Report.Name, ap.Result.Schema, func(emit func(gore.ResultItem) error) gore.QueryResult {
+		qr, err := ap.StreamData(ctx, args, emit)
 		if err != nil {
-			return err
+			qr.Error = err
 		}
+		return qr
+	})
+}
 
-		for _, item := range items {
-			itemMap := item.AsMap(ap.Report.Fields)
-			if err != nil {
-				return err
+// itemMap converts an item node into a map using the report fields. For
+// multi block reports any other values are also kept as strings.
+func (ap *ElexonAPI) itemMap(node gore.XmlNode) map[string]interface{} {
+	itemMap := node.AsMap(ap.Report.Fields)
+	if len(ap.Report.Multi) != 0 {
+		block, _ := itemMap["recordType"].(string)
+		for k, v := range node.AsMap(blockFields[ap.Report.Name][block]) {
+			itemMap[k] = v
+		}
+		for _, child := range node.Nodes {
+			if _, ck := itemMap[child.XMLName.Local]; ck || len(child.Nodes) != 0 {
+				continue
 			}
-			result := gore.ResultItem{Data: itemMap}
-			ap.Result.Results = append(ap.Result.Results, result)
+			itemMap[child.XMLName.Local] = string(child.Content)
+		}
+	}
+	for _, field := range localTimes[ap.Report.Name] {
+		if tm, ck := itemMap[field].(time.Time); ck {
+			itemMap[field] = londonToUTC(tm)
 		}
-		log.Printf("%s API call returned %d items", ap.Report.Name, len(ap.Result.Results))
 	}
+	addSettlementTime(itemMap)
+	return itemMap
+}
 
-	return nil
+// londonToUTC returns the UTC time for tm, whose date and time were given
+// as UK local time but parsed as UTC. Times in the hour repeated when the
+// clocks go back are ambiguous, and may be taken as either occurrence.
+func londonToUTC(tm time.Time) time.Time {
+	y, m, d := tm.Date()
+	return time.Date(y, m, d, tm.Hour(), tm.Minute(), tm.Second(), tm.Nanosecond(), gore.London()).UTC()
 }
 
-func queryResultFromResponse(xmlN gore.XmlNode) gore.QueryResult {
-	var qr gore.QueryResult
-	mMap, err := xmlN.GetAsMap("responseMetadata", metadataMap)
+// addSettlementTime adds the UTC start of the settlement period as
+// settlementTime for items that include a settlement date and period.
+func addSettlementTime(itemMap map[string]interface{}) {
+	if _, ck := itemMap["settlementPeriod"]; ck {
+		itemMap["settlementTime"] = nil
+	}
+	item := gore.ResultItem{Data: itemMap}
+	sd, ck := item.GetDate("settlementDate")
+	if !ck {
+		if sd, ck = item.GetDate("startTimeOfHalfHrPeriod"); !ck {
+			return
+		}
+	}
+	period, ck := item.GetInt("settlementPeriod")
+	if !ck {
+		num, err := strconv.Atoi(item.String("settlementPeriod"))
+		if err != nil {
+			return
+		}
+		period = num
+	}
+	start, _, err := gore.SettlementPeriodTimes(sd, period)
 	if err != nil {
-		qr.Completed = false
-		qr.Error = err
-		return qr
+		log.Printf("Unable to calculate settlement time: %s", err)
+		return
 	}
+	itemMap["settlementTime"] = start
+}
+
+func queryResultFromMetadata(node gore.XmlNode) gore.QueryResult {
+	var qr gore.QueryResult
+	mMap := node.AsMap(metadataMap)
 	qr.Completed = true
-	if mMap["httpCode"].(int) != 200 && mMap["httpCode"].(int) != 204 {
-		qr.Error = fmt.Errorf("%s: %s", mMap["errorType"].(string), mMap["description"].(string))
+	meta := gore.ResultItem{Data: mMap}
+	code, _ := meta.GetInt("httpCode")
+	if code != 200 && code != 204 {
+		qr.Error = &gore.HTTPError{StatusCode: code, Message: fmt.Sprintf("%s: %s", meta.String("errorType"), meta.String("description"))}
 		return qr
 	}
-	if mMap["httpCode"].(int) == 204 {
+	if code == 204 {
 		qr.Empty = true
 		return qr
 	}
-	_, ck := mMap["cappingApplied"]
-	if !ck {
-		return qr
-	}
-	if mMap["cappingApplied"].(bool) {
+	if meta.Bool("cappingApplied") {
 		qr.Capped = true
-		qr.CapLimit = mMap["cappingLimit"].(int)
+		qr.CapLimit = meta.Int("cappingLimit")
 	}
 	return qr
 }
@@ -0,0 +1,90 @@
+package elexon
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+func TestStreamDataCache(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		period := r.URL.Query().Get("Period")
+		mu.Lock()
+		calls[period]++
+		mu.Unlock()
+		code, capped, items := 200, "No", 1
+		switch period {
+		case "1":
+			capped = "Yes"
+		case "2":
+			code, items = 204, 0
+		case "3":
+			items = 0
+		}
+		fmt.Fprintf(w, `<response><responseMetadata><httpCode>%d</httpCode><errorType>Ok</errorType><description></description><cappingApplied>%s</cappingApplied><cappingLimit>1</cappingLimit><queryString></queryString></responseMetadata><responseBody><responseList>`, code, capped)
+		for i := 0; i < items; i++ {
+			fmt.Fprintf(w, `<item><settlementDate>2022-05-01</settlementDate><settlementPeriod>%s</settlementPeriod><quantity>1.5</quantity></item>`, period)
+		}
+		fmt.Fprint(w, `</responseList></responseBody></response>`)
+	}))
+	defer srv.Close()
+
+	cache, err := gore.NewDirCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		period string
+		calls  int
+	}{
+		{"1", 2}, // capped
+		{"2", 2}, // no content
+		{"3", 2}, // no items
+		{"4", 1},
+	}
+	for _, tc := range tests {
+		for i := 0; i < 2; i++ {
+			ap, err := NewElexonReport("b1630", WithBaseURL(srv.URL), WithCache(cache))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ap.GetData(map[string]string{"APIKey": "test", "SettlementDate": "2022-05-01", "Period": tc.period}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if calls[tc.period] != tc.calls {
+			t.Errorf("Period %s was requested %d times, want %d", tc.period, calls[tc.period], tc.calls)
+		}
+	}
+}
+
+func TestFuelinstLocalTime(t *testing.T) {
+	ap, err := NewElexonReport("fuelinst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		local string
+		want  time.Time
+	}{
+		{"2022-06-21 12:30:00", time.Date(2022, time.June, 21, 11, 30, 0, 0, time.UTC)},
+		{"2022-12-21 12:30:00", time.Date(2022, time.December, 21, 12, 30, 0, 0, time.UTC)},
+	}
+	for _, tc := range tests {
+		root, err := gore.ParseXML([]byte(fmt.Sprintf(`<item><recordType>FUELINST</recordType><publishingPeriodCommencingTime>%s</publishingPeriodCommencingTime></item>`, tc.local)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		item := gore.ResultItem{Data: ap.itemMap(root)}
+		if got, _ := item.GetDate("publishingPeriodCommencingTime"); !got.Equal(tc.want) || got.Location() != time.UTC {
+			t.Errorf("%s was converted to %s, want %s", tc.local, got, tc.want)
+		}
+	}
+}
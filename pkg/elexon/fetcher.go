@@ -0,0 +1,160 @@
+package elexon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// Fetcher runs a number of Elexon requests using a pool of workers, limiting
+// the rate at which requests are made and retrying those that fail with a
+// server error, a timeout or an empty response.
+type Fetcher struct {
+	// Concurrency is the number of requests that can be active at once.
+	Concurrency int
+	// RequestsPerSecond limits how often new requests are started. Zero
+	// means no limit.
+	RequestsPerSecond float64
+	// MaxRetries is the number of times a failed request will be retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry. It doubles for each
+	// subsequent retry.
+	Backoff time.Duration
+}
+
+// NewFetcher returns a Fetcher with sensible defaults for the BMRS API.
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Concurrency:       4,
+		RequestsPerSecond: 5,
+		MaxRetries:        3,
+		Backoff:           time.Second,
+	}
+}
+
+// GetDataRange gets data for every settlement date between from and to
+// (inclusive) and merges the results into ap in settlement order. Any
+// requests that failed are returned. If every request fails then
+// ap.Result.Query.Error is also set.
+func (f *Fetcher) GetDataRange(ctx context.Context, ap *ElexonAPI, from, to time.Time, args map[string]string) ([]RangeError, error) {
+	reqs, err := ap.rangeRequests(from, to, args)
+	if err != nil {
+		return nil, err
+	}
+	return f.run(ctx, ap, reqs), nil
+}
+
+// GetDataMany makes one request for each set of args, e.g. one per BM Unit,
+// and merges the results into ap. Any requests that failed are returned.
+func (f *Fetcher) GetDataMany(ctx context.Context, ap *ElexonAPI, argsList []map[string]string) []RangeError {
+	reqs := make([]rangeRequest, len(argsList))
+	for i, args := range argsList {
+		reqs[i].args = args
+		if sd, err := time.Parse("2006-01-02", args["SettlementDate"]); err == nil {
+			reqs[i].date = sd
+		}
+		if period, err := strconv.Atoi(args["Period"]); err == nil {
+			reqs[i].period = period
+		}
+	}
+	return f.run(ctx, ap, reqs)
+}
+
+func (f *Fetcher) run(ctx context.Context, ap *ElexonAPI, reqs []rangeRequest) []RangeError {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := f.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	var ticks <-chan time.Time
+	if f.RequestsPerSecond > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / f.RequestsPerSecond))
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	subs := make([]*ElexonAPI, len(reqs))
+	errs := make([]error, len(reqs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				subs[n], errs[n] = f.fetchOne(ctx, ap, reqs[n], ticks)
+			}
+		}()
+	}
+	for n := range reqs {
+		jobs <- n
+	}
+	close(jobs)
+	wg.Wait()
+
+	var failures []RangeError
+	var done []*ElexonAPI
+	for n, req := range reqs {
+		if errs[n] != nil {
+			failures = append(failures, RangeError{req.date, req.period, req.args, errs[n]})
+			continue
+		}
+		done = append(done, subs[n])
+	}
+	ap.mergeResults(done, failures)
+	return failures
+}
+
+func (f *Fetcher) fetchOne(ctx context.Context, ap *ElexonAPI, req rangeRequest, ticks <-chan time.Time) (*ElexonAPI, error) {
+	if req.period > 0 && !req.date.IsZero() {
+		if err := gore.ValidSettlementPeriod(req.date, req.period); err != nil {
+			return nil, err
+		}
+	}
+	backoff := f.Backoff
+	for attempt := 0; ; attempt++ {
+		if ticks != nil {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-ticks:
+			}
+		}
+		sub, err := ap.fetch(ctx, req.args)
+		if err == nil {
+			return sub, nil
+		}
+		if attempt >= f.MaxRetries || !retryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("%s request failed, retrying in %s: %s", ap.Report.Name, backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryable returns true for errors that may succeed if the request is made
+// again.
+func retryable(err error) bool {
+	var he *gore.HTTPError
+	if errors.As(err, &he) {
+		return he.Temporary()
+	}
+	if errors.Is(err, gore.ErrEmpty) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
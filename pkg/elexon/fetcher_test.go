@@ -0,0 +1,211 @@
+package elexon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// stubServer answers B1630 requests with one item for the settlement date
+// and period requested. If respond returns a status other than 200 that is
+// returned instead. The number of requests received is counted by date and
+// period.
+type stubServer struct {
+	*httptest.Server
+	respond func(r *http.Request, attempt int) int
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newStubServer(t *testing.T, respond func(r *http.Request, attempt int) int) *stubServer {
+	ss := &stubServer{respond: respond, calls: make(map[string]int)}
+	ss.Server = httptest.NewServer(http.HandlerFunc(ss.handle))
+	t.Cleanup(ss.Close)
+	return ss
+}
+
+func (ss *stubServer) handle(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sd, period := q.Get("SettlementDate"), q.Get("Period")
+	ss.mu.Lock()
+	ss.calls[sd+"/"+period]++
+	attempt := ss.calls[sd+"/"+period]
+	ss.mu.Unlock()
+
+	if ss.respond != nil {
+		if status := ss.respond(r, attempt); status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+	fmt.Fprintf(w, `<response>
+<responseMetadata><httpCode>200</httpCode><errorType>Ok</errorType><description></description><cappingApplied>No</cappingApplied><cappingLimit></cappingLimit><queryString></queryString></responseMetadata>
+<responseBody><responseList><item><settlementDate>%s</settlementDate><settlementPeriod>%s</settlementPeriod><quantity>1.5</quantity></item></responseList></responseBody>
+</response>`, sd, period)
+}
+
+func (ss *stubServer) total() int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	n := 0
+	for _, c := range ss.calls {
+		n += c
+	}
+	return n
+}
+
+func testAPI(t *testing.T, ss *stubServer) *ElexonAPI {
+	ap, err := NewElexonReport("b1630", WithBaseURL(ss.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ap.key = "test"
+	return ap
+}
+
+func testFetcher(concurrency int) *Fetcher {
+	return &Fetcher{Concurrency: concurrency, MaxRetries: 2, Backoff: time.Millisecond}
+}
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestFetcherRetriesServerErrors(t *testing.T) {
+	ss := newStubServer(t, func(r *http.Request, attempt int) int {
+		if attempt == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	ap := testAPI(t, ss)
+	failures, err := testFetcher(1).GetDataRange(context.Background(), ap, day(2022, time.May, 1), day(2022, time.May, 1), map[string]string{"Period": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 0 {
+		t.Fatalf("GetDataRange failed: %v", failures)
+	}
+	if n := ss.total(); n != 2 {
+		t.Errorf("Made %d requests, want 2", n)
+	}
+	if len(ap.Result.Results) != 1 {
+		t.Errorf("Returned %d results, want 1", len(ap.Result.Results))
+	}
+}
+
+func TestFetcherDoesNotRetryClientErrors(t *testing.T) {
+	ss := newStubServer(t, func(r *http.Request, attempt int) int {
+		return http.StatusBadRequest
+	})
+	ap := testAPI(t, ss)
+	failures, err := testFetcher(1).GetDataRange(context.Background(), ap, day(2022, time.May, 1), day(2022, time.May, 1), map[string]string{"Period": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ss.total(); n != 1 {
+		t.Errorf("Made %d requests, want 1", n)
+	}
+	var he *gore.HTTPError
+	if len(failures) != 1 || !errors.As(failures[0], &he) || he.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GetDataRange failures = %v, want one 400 error", failures)
+	}
+	if ap.Result.Query.Error == nil {
+		t.Error("Query.Error was not set when every request failed")
+	}
+}
+
+func TestFetcherRangeError(t *testing.T) {
+	ss := newStubServer(t, func(r *http.Request, attempt int) int {
+		if r.URL.Query().Get("SettlementDate") == "2022-05-02" {
+			return http.StatusNotFound
+		}
+		return http.StatusOK
+	})
+	ap := testAPI(t, ss)
+	failures, err := testFetcher(2).GetDataRange(context.Background(), ap, day(2022, time.May, 1), day(2022, time.May, 3), map[string]string{"Period": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("GetDataRange failures = %v, want 1", failures)
+	}
+	fail := failures[0]
+	if !fail.SettlementDate.Equal(day(2022, time.May, 2)) || fail.Period != 1 || !strings.HasPrefix(fail.Error(), "2022-05-02 period 1: ") {
+		t.Errorf("RangeError = %s, want one for 2022-05-02 period 1", fail)
+	}
+	if ap.Result.Query.Error != nil || len(ap.Result.Results) != 2 {
+		t.Errorf("Results = %d with error %v, want 2 and no error", len(ap.Result.Results), ap.Result.Query.Error)
+	}
+}
+
+func TestFetcherSettlementOrder(t *testing.T) {
+	ss := newStubServer(t, func(r *http.Request, attempt int) int {
+		// Answer the earlier periods last.
+		if r.URL.Query().Get("Period") == "1" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return http.StatusOK
+	})
+	ap := testAPI(t, ss)
+	var argsList []map[string]string
+	for _, args := range []struct{ sd, period string }{
+		{"2022-05-02", "1"}, {"2022-05-01", "3"}, {"2022-05-01", "1"}, {"2022-05-01", "2"},
+	} {
+		argsList = append(argsList, map[string]string{"SettlementDate": args.sd, "Period": args.period})
+	}
+	if failures := testFetcher(4).GetDataMany(context.Background(), ap, argsList); len(failures) != 0 {
+		t.Fatalf("GetDataMany failed: %v", failures)
+	}
+	var got []string
+	for _, item := range ap.Result.Results {
+		start, _ := item.GetDate("settlementTime")
+		got = append(got, start.Format("2006-01-02 15:04"))
+	}
+	want := []string{"2022-04-30 23:00", "2022-04-30 23:30", "2022-05-01 00:00", "2022-05-01 23:00"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Results are in the order %v, want %v", got, want)
+	}
+}
+
+func TestFetcherCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ss := newStubServer(t, func(r *http.Request, attempt int) int {
+		cancel()
+		<-r.Context().Done()
+		return http.StatusServiceUnavailable
+	})
+	ap := testAPI(t, ss)
+	done := make(chan []RangeError)
+	go func() {
+		failures, _ := testFetcher(1).GetDataRange(ctx, ap, day(2022, time.May, 1), day(2022, time.May, 10), map[string]string{"Period": "1"})
+		done <- failures
+	}()
+	var failures []RangeError
+	select {
+	case failures = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetDataRange did not return after the context was cancelled")
+	}
+	if len(failures) != 10 {
+		t.Fatalf("GetDataRange returned %d failures, want 10", len(failures))
+	}
+	for _, fail := range failures {
+		if !errors.Is(fail, context.Canceled) {
+			t.Errorf("%s was not cancelled", fail)
+		}
+	}
+	if n := ss.total(); n != 1 {
+		t.Errorf("Made %d requests after the context was cancelled", n-1)
+	}
+}
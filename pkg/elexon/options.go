@@ -0,0 +1,84 @@
+package elexon
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// DefaultBaseURL is the BMRS API endpoint used unless WithBaseURL is given.
+const DefaultBaseURL = "https://api.bmreports.com/BMRS/"
+
+type apiConfig struct {
+	client    *http.Client
+	baseURL   string
+	userAgent string
+	timeout   time.Duration
+	capture   gore.Capturer
+	cache     gore.Cache
+}
+
+// Option configures how an ElexonAPI makes requests.
+type Option func(*apiConfig)
+
+// WithHTTPClient sets the client used for all requests, e.g. to use a proxy.
+// A nil client uses http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *apiConfig) {
+		c.client = client
+	}
+}
+
+// WithBaseURL sets the URL that report names are appended to, e.g. to use a
+// mirror or a local test server.
+func WithBaseURL(base string) Option {
+	return func(c *apiConfig) {
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		c.baseURL = base
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(c *apiConfig) {
+		c.userAgent = ua
+	}
+}
+
+// WithTimeout limits how long a single request may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *apiConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithCapture passes the raw content of every response to capture.
+func WithCapture(capture gore.Capturer) Option {
+	return func(c *apiConfig) {
+		c.capture = capture
+	}
+}
+
+// WithCache answers requests from cache when possible, storing successful
+// responses in it. How long responses are kept depends on the report and
+// whether the dates requested are in the past.
+func WithCache(cache gore.Cache) Option {
+	return func(c *apiConfig) {
+		c.cache = cache
+	}
+}
+
+func newAPIConfig(opts []Option) apiConfig {
+	cfg := apiConfig{client: http.DefaultClient, baseURL: DefaultBaseURL}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.client == nil {
+		cfg.client = http.DefaultClient
+	}
+	return cfg
+}
@@ -0,0 +1,158 @@
+package elexon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// RangeError records a single request within a range that failed.
+type RangeError struct {
+	SettlementDate time.Time
+	Period         int
+	Args           map[string]string
+	Err            error
+}
+
+func (re RangeError) Error() string {
+	if re.Period > 0 {
+		return fmt.Sprintf("%s period %d: %s", re.SettlementDate.Format("2006-01-02"), re.Period, re.Err)
+	}
+	return fmt.Sprintf("%s: %s", re.SettlementDate.Format("2006-01-02"), re.Err)
+}
+
+func (re RangeError) Unwrap() error {
+	return re.Err
+}
+
+type rangeRequest struct {
+	date   time.Time
+	period int
+	args   map[string]string
+}
+
+// rangeRequests splits the range from -> to (inclusive) into one request per
+// settlement date. If the report requires a Period and none was supplied in
+// args then one request is made for every period of each day.
+func (ap *ElexonAPI) rangeRequests(from, to time.Time, args map[string]string) ([]rangeRequest, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("The end of the range (%s) is before the start (%s)", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+	fixedPeriod := 0
+	if pStr, ck := args["Period"]; ck {
+		num, err := strconv.Atoi(pStr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Period '%s': %s", pStr, err)
+		}
+		fixedPeriod = num
+	}
+	hasPeriod := fixedPeriod != 0
+	perPeriod := false
+	for _, rqd := range ap.Report.RqdParams {
+		if rqd == "Period" && !hasPeriod {
+			perPeriod = true
+		}
+	}
+
+	var reqs []rangeRequest
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		periods := []int{fixedPeriod}
+		if perPeriod {
+			periods = make([]int, gore.SettlementPeriods(day))
+			for i := range periods {
+				periods[i] = i + 1
+			}
+		}
+		for _, period := range periods {
+			rArgs := make(map[string]string, len(args)+2)
+			for k, v := range args {
+				rArgs[k] = v
+			}
+			rArgs["SettlementDate"] = day.Format("2006-01-02")
+			if period > 0 {
+				rArgs["Period"] = fmt.Sprintf("%d", period)
+			}
+			reqs = append(reqs, rangeRequest{day, period, rArgs})
+		}
+	}
+	return reqs, nil
+}
+
+// fetch runs a single request using a copy of the report configuration so
+// that the results are kept apart from ap.
+func (ap *ElexonAPI) fetch(ctx context.Context, args map[string]string) (*ElexonAPI, error) {
+	sub := &ElexonAPI{Report: ap.Report, key: ap.key, cfg: ap.cfg}
+	sub.Result.QueryName = ap.Result.QueryName
+	sub.Result.Schema = ap.Result.Schema
+	if err := sub.GetDataContext(ctx, args); err != nil {
+		return sub, err
+	}
+	if sub.Result.Query.Error != nil {
+		return sub, sub.Result.Query.Error
+	}
+	return sub, nil
+}
+
+// GetDataRange gets data for every settlement date between from and to
+// (inclusive), one request at a time, merging the results into ap.Result
+// (and ap.MultiResults) in settlement order. Any requests that failed are
+// returned. If every request fails then ap.Result.Query.Error is also set.
+// Use a Fetcher to make the requests concurrently.
+func (ap *ElexonAPI) GetDataRange(from, to time.Time, args map[string]string) ([]RangeError, error) {
+	f := Fetcher{Concurrency: 1}
+	return f.GetDataRange(context.Background(), ap, from, to, args)
+}
+
+func (ap *ElexonAPI) mergeResults(subs []*ElexonAPI, failures []RangeError) {
+	ap.Result.Results = nil
+	ap.Result.Query = gore.QueryResult{}
+	if len(subs) == 0 {
+		if len(failures) > 0 {
+			ap.Result.Query.Error = failures[0]
+		}
+		return
+	}
+	ap.Result.Query.Completed = true
+	if len(ap.Report.Multi) > 0 {
+		ap.MultiResults = make(map[string]gore.ResultSet)
+	}
+	for _, sub := range subs {
+		if sub.Result.Query.Capped {
+			ap.Result.Query.Capped = true
+			ap.Result.Query.CapLimit = sub.Result.Query.CapLimit
+		}
+		ap.Result.Results = append(ap.Result.Results, sub.Result.Results...)
+		for block, rs := range sub.MultiResults {
+			merged, ck := ap.MultiResults[block]
+			if !ck {
+				merged = gore.ResultSet{QueryName: block, Schema: rs.Schema}
+			}
+			merged.Query = ap.Result.Query
+			merged.Results = append(merged.Results, rs.Results...)
+			ap.MultiResults[block] = merged
+		}
+	}
+	sortBySettlementTime(ap.Result.Results)
+	for block, rs := range ap.MultiResults {
+		sortBySettlementTime(rs.Results)
+		ap.MultiResults[block] = rs
+	}
+	ap.Result.Query.Empty = len(ap.Result.Results) == 0 && len(ap.MultiResults) == 0
+}
+
+// sortBySettlementTime sorts the items by settlementTime, keeping those
+// without one in their original order after the rest.
+func sortBySettlementTime(items []gore.ResultItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		ti, ck1 := items[i].GetDate("settlementTime")
+		tj, ck2 := items[j].GetDate("settlementTime")
+		if !ck1 || !ck2 {
+			return ck1 && !ck2
+		}
+		return ti.Before(tj)
+	})
+}
@@ -6,14 +6,20 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
 )
 
 type ElexonReport struct {
-	Name         string
-	Description  string
-	Version      string
-	Fields       map[string]string
-	RqdParams    []string
+	Name        string
+	Description string
+	Version     string
+	Fields      map[string]string
+	RqdParams   []string
+	// Multi lists the record types returned by reports that contain several
+	// blocks of data, mapped to a description. Fields are those common to all
+	// blocks, with the fields for each block given in blockFields. Any other
+	// values are kept as strings.
 	Multi        map[string]string
 	updateParams func(url.Values)
 }
@@ -148,9 +154,27 @@ var ElexonReports = map[string]ElexonReport{
 		"DERBMDATA",
 		"Derived BM Unit Data",
 		"v1",
-		map[string]string{},
-		[]string{},
-		map[string]string{},
+		map[string]string{
+			"recordType":       "string",
+			"bMUnitID":         "string",
+			"bMUnitType":       "string",
+			"leadPartyName":    "string",
+			"nGCBMUnitName":    "string",
+			"settlementDate":   "date",
+			"settlementPeriod": "int",
+			"activeFlag":       "bool",
+		},
+		[]string{"SettlementDate"},
+		map[string]string{
+			"BOALF":   "Bid Offer Acceptance Level Flagged",
+			"BOAV":    "Bid Offer Acceptance Volumes",
+			"DISPTAV": "Disaggregated Period Total Accepted Volumes",
+			"EBOCF":   "Indicative Bid Offer Cashflows",
+			"MEL":     "Maximum Export Limit",
+			"MIL":     "Maximum Import Limit",
+			"PN":      "Physical Notification",
+			"PTAV":    "Period Total Accepted Volumes",
+		},
 		nil,
 	},
 	"dersysdata": {
@@ -217,13 +241,138 @@ var ElexonReports = map[string]ElexonReport{
 		nil,
 	},
 	"bmunitsearch": {
-		Name:         "BMUNITSEARCH",
-		Description:  "BM Unit Search",
-		Version:      "v1",
+		Name:        "BMUNITSEARCH",
+		Description: "BM Unit Search",
+		Version:     "v1",
+		Fields: map[string]string{
+			"recordType":    "string",
+			"bMUnitID":      "string",
+			"bMUnitType":    "string",
+			"leadPartyName": "string",
+			"nGCBMUnitName": "string",
+			"activeFlag":    "bool",
+		},
 		updateParams: searchNames,
 	},
 }
 
+// levelFields are used by the blocks that give a level between two times.
+var levelFields = map[string]string{
+	"timeFrom":  "dateTime",
+	"levelFrom": "float",
+	"timeTo":    "dateTime",
+	"levelTo":   "float",
+}
+
+// blockFields lists the fields of each block of a multi block report, in
+// addition to the report Fields.
+var blockFields = map[string]map[string]map[string]string{
+	"DERBMDATA": {
+		"BOALF": {
+			"acceptanceNumber":   "int",
+			"acceptanceTime":     "dateTime",
+			"deemedBidOfferFlag": "bool",
+			"soFlag":             "bool",
+			"storProviderFlag":   "bool",
+			"rrScheduleFlag":     "bool",
+			"timeFrom":           "dateTime",
+			"levelFrom":          "float",
+			"timeTo":             "dateTime",
+			"levelTo":            "float",
+		},
+		"BOAV": {
+			"acceptanceNumber":   "int",
+			"bidOfferPairNumber": "int",
+			"offerVolume":        "float",
+			"bidVolume":          "float",
+		},
+		"DISPTAV": {
+			"bidOfferPairNumber":          "int",
+			"offerVolume":                 "float",
+			"bidVolume":                   "float",
+			"originalOfferVolume":         "float",
+			"originalBidVolume":           "float",
+			"taggedOfferVolume":           "float",
+			"taggedBidVolume":             "float",
+			"repricedOfferVolume":         "float",
+			"repricedBidVolume":           "float",
+			"originallyPricedOfferVolume": "float",
+			"originallyPricedBidVolume":   "float",
+		},
+		"EBOCF": {
+			"bidOfferPairNumber": "int",
+			"offerCashflow":      "float",
+			"bidCashflow":        "float",
+		},
+		"MEL": levelFields,
+		"MIL": levelFields,
+		"PN":  levelFields,
+		"PTAV": {
+			"bidOfferPairNumber": "int",
+			"offerVolume":        "float",
+			"bidVolume":          "float",
+		},
+	},
+}
+
+// fields returns the fields for items in block, which are the report Fields
+// together with any for the block.
+func (er ElexonReport) fields(block string) map[string]string {
+	extra := blockFields[er.Name][block]
+	if len(extra) == 0 {
+		return er.Fields
+	}
+	fields := make(map[string]string, len(er.Fields)+len(extra))
+	for k, v := range er.Fields {
+		fields[k] = v
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	return fields
+}
+
+// reportKeys lists the fields that identify a single result for each report.
+var reportKeys = map[string][]string{
+	"B1320":        {"timeSeriesID", "settlementDate", "settlementPeriod"},
+	"B1330":        {"timeSeriesID", "year", "month"},
+	"B1420":        {"registeredResourceEICCode", "year"},
+	"B1610":        {"bMUnitID", "settlementDate", "settlementPeriod"},
+	"B1630":        {"powerSystemResourceType", "settlementDate", "settlementPeriod"},
+	"BMUNITSEARCH": {"bMUnitID"},
+	"DERSYSDATA":   {"settlementDate", "settlementPeriod"},
+	"FUELINST":     {"publishingPeriodCommencingTime"},
+}
+
+// localTimes lists the dateTime fields of each report that are given as UK
+// local time without an offset. They are converted to UTC, like the
+// settlementTime, so that they are unambiguous when stored or sorted.
+var localTimes = map[string][]string{
+	"FUELINST": {"publishingPeriodCommencingTime"},
+}
+
+// blockKeys lists the fields that identify a single result in each block of
+// a multi block report.
+var blockKeys = map[string]map[string][]string{
+	"DERBMDATA": {
+		"BOALF":   {"bMUnitID", "settlementDate", "settlementPeriod", "acceptanceNumber", "timeFrom"},
+		"BOAV":    {"bMUnitID", "settlementDate", "settlementPeriod", "acceptanceNumber", "bidOfferPairNumber"},
+		"DISPTAV": {"bMUnitID", "settlementDate", "settlementPeriod", "bidOfferPairNumber"},
+		"EBOCF":   {"bMUnitID", "settlementDate", "settlementPeriod", "bidOfferPairNumber"},
+		"MEL":     {"bMUnitID", "settlementDate", "settlementPeriod", "timeFrom"},
+		"MIL":     {"bMUnitID", "settlementDate", "settlementPeriod", "timeFrom"},
+		"PN":      {"bMUnitID", "settlementDate", "settlementPeriod", "timeFrom"},
+		"PTAV":    {"bMUnitID", "settlementDate", "settlementPeriod", "bidOfferPairNumber"},
+	},
+}
+
+// reportCacheTTL overrides gore.DefaultCacheTTL for reports whose data
+// changes more or less often than most.
+var reportCacheTTL = map[string]gore.CacheTTL{
+	"B1420":    {Past: 30 * 24 * time.Hour, Current: 24 * time.Hour},
+	"FUELINST": {Past: 7 * 24 * time.Hour, Current: 5 * time.Minute},
+}
+
 func textMonth(current url.Values) {
 	for k, v := range current {
 		if k == "Month" {
@@ -0,0 +1,115 @@
+package gore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache stores the raw content of responses so that repeated requests can be
+// answered without contacting the server. Key identifies the request and
+// Get only returns content stored less than ttl ago.
+type Cache interface {
+	Get(key string, ttl time.Duration) ([]byte, bool)
+	Put(key string, content []byte) error
+}
+
+// CacheTTL gives how long cached responses remain valid. Data for dates
+// before today rarely changes so can be kept for longer than current data.
+type CacheTTL struct {
+	Past    time.Duration
+	Current time.Duration
+}
+
+// DefaultCacheTTL is used for reports without a more specific CacheTTL.
+var DefaultCacheTTL = CacheTTL{Past: 7 * 24 * time.Hour, Current: 15 * time.Minute}
+
+// For returns the TTL for a response whose data ends on last. A zero last,
+// i.e. the latest data, uses the Current TTL.
+func (ct CacheTTL) For(last time.Time) time.Duration {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if !last.IsZero() && last.Before(today) {
+		return ct.Past
+	}
+	return ct.Current
+}
+
+// DirCache stores each response as a file in a directory, using a hash of
+// the key as the filename.
+type DirCache struct {
+	Dir string
+	// Refresh ignores any cached content, although new responses are
+	// still stored.
+	Refresh bool
+}
+
+// NewDirCache returns a DirCache for dir, creating it if needed.
+func NewDirCache(dir string) (*DirCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Unable to create cache directory %s: %s", dir, err)
+	}
+	return &DirCache{Dir: dir}, nil
+}
+
+func (dc *DirCache) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dc.Dir, hex.EncodeToString(sum[:])+".cache")
+}
+
+func (dc *DirCache) Get(key string, ttl time.Duration) ([]byte, bool) {
+	rdr, ck := dc.Open(key, ttl)
+	if !ck {
+		return nil, false
+	}
+	defer rdr.Close()
+	content, err := io.ReadAll(rdr)
+	if err != nil {
+		return nil, false
+	}
+	return content, true
+}
+
+// Open returns the cached content for key as a stream.
+func (dc *DirCache) Open(key string, ttl time.Duration) (io.ReadCloser, bool) {
+	if dc.Refresh || ttl <= 0 {
+		return nil, false
+	}
+	fn := dc.filename(key)
+	info, err := os.Stat(fn)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return nil, false
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, false
+	}
+	return f, true
+}
+
+func (dc *DirCache) Put(key string, content []byte) error {
+	return dc.PutFrom(key, bytes.NewReader(content))
+}
+
+// PutFrom stores the content read from r.
+func (dc *DirCache) PutFrom(key string, r io.Reader) error {
+	// Write to a temporary file first so a partial response is never read.
+	tmp, err := os.CreateTemp(dc.Dir, "put-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dc.filename(key))
+}
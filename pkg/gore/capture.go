@@ -0,0 +1,85 @@
+package gore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Capturer is given the raw content of responses received so that they can
+// be kept, e.g. for audit or debugging. Name identifies the report or
+// request that generated the content.
+type Capturer interface {
+	Capture(name string, content []byte) error
+}
+
+// CaptureFunc allows a function to be used as a Capturer.
+type CaptureFunc func(name string, content []byte) error
+
+func (cf CaptureFunc) Capture(name string, content []byte) error {
+	return cf(name, content)
+}
+
+// DirCapturer writes each captured response into a directory using a
+// timestamped filename.
+type DirCapturer struct {
+	Dir string
+
+	seq uint64
+}
+
+// NewDirCapturer returns a DirCapturer for dir, creating it if needed.
+func NewDirCapturer(dir string) (*DirCapturer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Unable to create capture directory %s: %s", dir, err)
+	}
+	return &DirCapturer{Dir: dir}, nil
+}
+
+func (dc *DirCapturer) Capture(name string, content []byte) error {
+	return dc.CaptureFrom(name, bytes.NewReader(content))
+}
+
+// CaptureFrom captures the content read from r.
+func (dc *DirCapturer) CaptureFrom(name string, r io.Reader) error {
+	br := bufio.NewReader(r)
+	ext := ".data"
+	start, _ := br.Peek(512)
+	if bytes.HasPrefix(bytes.TrimSpace(start), []byte("<")) {
+		ext = ".xml"
+	}
+	seq := atomic.AddUint64(&dc.seq, 1)
+	fn := fmt.Sprintf("%s_%s_%04d%s", safeFilename(name), time.Now().UTC().Format("20060102T150405.000Z"), seq, ext)
+	f, err := os.Create(filepath.Join(dc.Dir, fn))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, br); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// safeFilename replaces any characters in name that are not safe to use in
+// a filename, such as path separators, so the file is always written in the
+// capture directory.
+func safeFilename(name string) string {
+	safe := strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, name), "._")
+	if safe == "" {
+		return "capture"
+	}
+	return safe
+}
@@ -0,0 +1,91 @@
+package gore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the elexon and ofgem packages can be tested for these
+// using errors.Is.
+var (
+	// ErrAuth is returned when the server rejects the credentials supplied,
+	// e.g. an invalid Elexon APIKey.
+	ErrAuth = errors.New("Authentication failed")
+	// ErrCapped is returned by QueryResult.Err when the server limited the
+	// number of items returned.
+	ErrCapped = errors.New("Response was capped")
+	// ErrEmpty is returned when a response contained no data.
+	ErrEmpty = errors.New("Empty response")
+	// ErrUpstream is returned when the server responds with an HTTP error.
+	ErrUpstream = errors.New("Upstream server error")
+	// ErrFormChanged is returned when an expected element of an Ofgem form,
+	// such as a label or dropdown, cannot be found.
+	ErrFormChanged = errors.New("Form structure has changed")
+	// ErrRedirect is returned when the server unexpectedly redirects.
+	ErrRedirect = errors.New("Unexpected redirect")
+	// ErrParse is returned when a response cannot be parsed.
+	ErrParse = errors.New("Unable to parse response")
+)
+
+// HTTPError is returned when a server responds with an unexpected status
+// code. It matches ErrUpstream, and also ErrAuth for 401 and 403 responses.
+type HTTPError struct {
+	StatusCode int
+	URL        string
+	Message    string
+}
+
+func (he *HTTPError) Error() string {
+	msg := fmt.Sprintf("Server responded with a status code %d", he.StatusCode)
+	if len(he.Message) > 0 {
+		msg += ": " + he.Message
+	}
+	if len(he.URL) > 0 {
+		msg += ". Url was " + he.URL
+	}
+	return msg
+}
+
+func (he *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrUpstream:
+		return true
+	case ErrAuth:
+		return he.StatusCode == 401 || he.StatusCode == 403
+	}
+	return false
+}
+
+// Temporary returns true if the request may succeed if retried.
+func (he *HTTPError) Temporary() bool {
+	return he.StatusCode >= 500
+}
+
+// RedirectError is returned when the server redirects to another page
+// rather than returning the expected response. It matches ErrRedirect.
+type RedirectError struct {
+	URL string
+}
+
+func (re *RedirectError) Error() string {
+	return fmt.Sprintf("Received pageRedirect to %s", re.URL)
+}
+
+func (re *RedirectError) Is(target error) bool {
+	return target == ErrRedirect
+}
+
+// Err returns the error for the query, if any. Capped and empty responses
+// are reported as ErrCapped and ErrEmpty, although their results are valid.
+func (qr QueryResult) Err() error {
+	if qr.Error != nil {
+		return qr.Error
+	}
+	if qr.Capped {
+		return fmt.Errorf("%w at %d items", ErrCapped, qr.CapLimit)
+	}
+	if qr.Empty {
+		return ErrEmpty
+	}
+	return nil
+}
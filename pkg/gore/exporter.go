@@ -0,0 +1,161 @@
+package gore
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Exporter writes results one at a time, allowing them to be exported as
+// they are received. Close must be called once all results are written.
+type Exporter interface {
+	Write(item ResultItem) error
+	Close() error
+}
+
+// NewExporter returns an Exporter writing to w in the given format. For CSV
+// the columns are taken from the schema, or from the first result if the
+// schema is empty.
+func NewExporter(w io.Writer, xFmt string, schema Schema, delimiter rune) (Exporter, error) {
+	switch strings.ToLower(xFmt) {
+	case "xml":
+		return newXMLExporter(w)
+	case "json":
+		return newJSONExporter(w)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Comma = delimiter
+		return &csvExporter{cw: cw, schema: schema, columns: schema.Names()}, nil
+	}
+	return nil, fmt.Errorf("Unknown export format '%s'", xFmt)
+}
+
+type xmlExporter struct {
+	w   io.Writer
+	enc *xml.Encoder
+}
+
+func newXMLExporter(w io.Writer) (*xmlExporter, error) {
+	if _, err := io.WriteString(w, "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\"?><Results>"); err != nil {
+		return nil, err
+	}
+	return &xmlExporter{w: w, enc: xml.NewEncoder(w)}, nil
+}
+
+func (xe *xmlExporter) Write(item ResultItem) error {
+	return xe.enc.EncodeElement(item, xml.StartElement{Name: xml.Name{Local: "ResultItem"}})
+}
+
+func (xe *xmlExporter) Close() error {
+	if err := xe.enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(xe.w, "</Results>")
+	return err
+}
+
+type jsonExporter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONExporter(w io.Writer) (*jsonExporter, error) {
+	if _, err := io.WriteString(w, "{\"Results\":["); err != nil {
+		return nil, err
+	}
+	return &jsonExporter{w: w}, nil
+}
+
+func (je *jsonExporter) Write(item ResultItem) error {
+	content, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if je.count > 0 {
+		if _, err := io.WriteString(je.w, ","); err != nil {
+			return err
+		}
+	}
+	je.count++
+	_, err = je.w.Write(content)
+	return err
+}
+
+func (je *jsonExporter) Close() error {
+	_, err := io.WriteString(je.w, "]}")
+	return err
+}
+
+type csvExporter struct {
+	cw      *csv.Writer
+	schema  Schema
+	columns []string
+	types   []string
+	started bool
+}
+
+func (ce *csvExporter) Write(item ResultItem) error {
+	if !ce.started {
+		ce.started = true
+		if len(ce.columns) == 0 {
+			for k := range item.Data {
+				ce.columns = append(ce.columns, k)
+			}
+			sort.Strings(ce.columns)
+		}
+		ce.types = ce.schema.Types(ce.columns)
+		if err := ce.cw.Write(ce.columns); err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(ce.columns))
+	for i, col := range ce.columns {
+		row[i] = csvValue(item.Data[col], ce.types[i])
+	}
+	return ce.cw.Write(row)
+}
+
+func (ce *csvExporter) Close() error {
+	if !ce.started && len(ce.columns) > 0 {
+		ce.cw.Write(ce.columns)
+	}
+	ce.cw.Flush()
+	return ce.cw.Error()
+}
+
+// Export writes the remaining results in the stream to filename as they are
+// received. The stream is always closed when Export returns.
+func (rs *ResultStream) Export(filename, xFmt string, delimiter rune) error {
+	defer rs.Close()
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = rs.write(f, xFmt, delimiter)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// write writes the remaining results in the stream to w.
+func (rs *ResultStream) write(w io.Writer, xFmt string, delimiter rune) error {
+	exp, err := NewExporter(w, xFmt, rs.Schema, delimiter)
+	if err != nil {
+		return err
+	}
+	for rs.Next() {
+		if err := exp.Write(rs.Item()); err != nil {
+			return err
+		}
+	}
+	if err := exp.Close(); err != nil {
+		return err
+	}
+	return rs.Err()
+}
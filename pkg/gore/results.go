@@ -2,10 +2,16 @@ package gore
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,6 +19,7 @@ import (
 type ResultSet struct {
 	QueryName string
 	Query     QueryResult
+	Schema    Schema
 	Results   []ResultItem
 }
 
@@ -28,44 +35,77 @@ type ResultItem struct {
 	Data map[string]interface{} `json:"ResultItem"`
 }
 
+// IsNull returns true if the named value is missing or null.
+func (ri ResultItem) IsNull(name string) bool {
+	return ri.Data[name] == nil
+}
+
+// GetInt returns the named value and true if it is present and an int.
+func (ri ResultItem) GetInt(name string) (int, bool) {
+	v, ck := ri.Data[name].(int)
+	return v, ck
+}
+
+// GetFloat returns the named value and true if it is present and numeric.
+// Integer values are converted.
+func (ri ResultItem) GetFloat(name string) (float64, bool) {
+	switch v := ri.Data[name].(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// GetString returns the named value and true if it is present and a string.
+func (ri ResultItem) GetString(name string) (string, bool) {
+	v, ck := ri.Data[name].(string)
+	return v, ck
+}
+
+// GetBool returns the named value and true if it is present and a bool.
+func (ri ResultItem) GetBool(name string) (bool, bool) {
+	v, ck := ri.Data[name].(bool)
+	return v, ck
+}
+
+// GetDate returns the named value and true if it is present and a time.
+func (ri ResultItem) GetDate(name string) (time.Time, bool) {
+	v, ck := ri.Data[name].(time.Time)
+	return v, ck
+}
+
 func (ri ResultItem) Int(name string) int {
-	v, ck := ri.Data[name]
+	v, ck := ri.GetInt(name)
 	if !ck {
 		return -1
 	}
-	return v.(int)
+	return v
 }
 
 func (ri ResultItem) Float(name string) float64 {
-	v, ck := ri.Data[name]
+	v, ck := ri.GetFloat(name)
 	if !ck {
 		return -1
 	}
-	return v.(float64)
+	return v
 }
 
 func (ri ResultItem) String(name string) string {
-	v, ck := ri.Data[name]
-	if !ck {
-		return ""
-	}
-	return v.(string)
+	v, _ := ri.GetString(name)
+	return v
 }
 
 func (ri ResultItem) Bool(name string) bool {
-	v, ck := ri.Data[name]
-	if !ck {
-		return false
-	}
-	return v.(bool)
+	v, _ := ri.GetBool(name)
+	return v
 }
 
+// Date returns the named value, or the zero time if it is missing or null.
 func (ri ResultItem) Date(name string) time.Time {
-	v, ck := ri.Data[name]
-	if !ck || v == nil {
-		return time.Now()
-	}
-	return v.(time.Time)
+	v, _ := ri.GetDate(name)
+	return v
 }
 
 func (rs ResultSet) Export(filename, xFmt string) (err error) {
@@ -82,7 +122,9 @@ func (rs ResultSet) Export(filename, xFmt string) (err error) {
 		suffix = []byte("}")
 		content, err = json.Marshal(rs.Results)
 	case "csv":
-		err = fmt.Errorf("CSV exporting not yet implemented")
+		return rs.ExportCSV(filename, ',')
+	default:
+		err = fmt.Errorf("Unknown export format '%s'", xFmt)
 	}
 	if err != nil {
 		return
@@ -91,6 +133,145 @@ func (rs ResultSet) Export(filename, xFmt string) (err error) {
 	return ioutil.WriteFile(filename, bytes.Join([][]byte{prefix, content, suffix}, []byte("")), 0644)
 }
 
+// ExportCSV writes the results to filename as CSV using the supplied delimiter.
+func (rs ResultSet) ExportCSV(filename string, delimiter rune) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := rs.WriteCSV(f, delimiter); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteCSV writes a header row followed by one row per result. Columns are
+// sorted by name so the output is stable between runs.
+func (rs ResultSet) WriteCSV(w io.Writer, delimiter rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = delimiter
+
+	columns := rs.Columns()
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	types := rs.Schema.Types(columns)
+	row := make([]string, len(columns))
+	for _, item := range rs.Results {
+		for i, col := range columns {
+			row[i] = csvValue(item.Data[col], types[i])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Columns returns the sorted names of every field in the schema and every
+// field present in the results.
+func (rs ResultSet) Columns() []string {
+	seen := make(map[string]bool)
+	columns := rs.Schema.Names()
+	for _, name := range columns {
+		seen[name] = true
+	}
+	for _, item := range rs.Results {
+		for k := range item.Data {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// csvValue formats v for a CSV cell. Times are formatted according to the
+// schema type of the column, so every row of a column uses the same format.
+func csvValue(v interface{}, typ string) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if typ == "date" {
+			return val.Format("2006-01-02")
+		}
+		return val.Format("2006-01-02 15:04:05")
+	case bool:
+		return strconv.FormatBool(val)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// ExportMulti exports a number of named result sets. JSON and XML exports
+// are written to filename with one section per set, while CSV exports are
+// written to one file per set with the set name added to the filename.
+func ExportMulti(sets map[string]ResultSet, filename, xFmt string, delimiter rune) error {
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	switch strings.ToLower(xFmt) {
+	case "csv":
+		ext := filepath.Ext(filename)
+		base := strings.TrimSuffix(filename, ext)
+		for _, name := range names {
+			if err := sets[name].ExportCSV(fmt.Sprintf("%s_%s%s", base, name, ext), delimiter); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		results := make(map[string][]ResultItem)
+		for _, name := range names {
+			results[name] = sets[name].Results
+		}
+		content, err := json.Marshal(map[string]map[string][]ResultItem{"Results": results})
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filename, content, 0644)
+	case "xml":
+		var buf bytes.Buffer
+		buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\"?>")
+		enc := xml.NewEncoder(&buf)
+		root := xml.StartElement{Name: xml.Name{Local: "Results"}}
+		if err := enc.EncodeToken(root); err != nil {
+			return err
+		}
+		for _, name := range names {
+			section := xml.StartElement{Name: xml.Name{Local: "ResultSet"}, Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}}}
+			if err := enc.EncodeToken(section); err != nil {
+				return err
+			}
+			for _, item := range sets[name].Results {
+				if err := enc.EncodeElement(item, xml.StartElement{Name: xml.Name{Local: "ResultItem"}}); err != nil {
+					return err
+				}
+			}
+			if err := enc.EncodeToken(section.End()); err != nil {
+				return err
+			}
+		}
+		if err := enc.EncodeToken(root.End()); err != nil {
+			return err
+		}
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+	}
+	return fmt.Errorf("Unknown export format '%s'", xFmt)
+}
+
 type xmlMapEntry struct {
 	XMLName xml.Name
 	Value   interface{} `xml:",chardata"`
@@ -107,8 +288,19 @@ func (ri ResultItem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 		return err
 	}
 
-	for k, v := range ri.Data {
-		e.Encode(xmlMapEntry{XMLName: xml.Name{Local: k}, Value: v})
+	keys := make([]string, 0, len(ri.Data))
+	for k := range ri.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// Null values are omitted from the XML output.
+		if ri.Data[k] == nil {
+			continue
+		}
+		if err := e.Encode(xmlMapEntry{XMLName: xml.Name{Local: k}, Value: ri.Data[k]}); err != nil {
+			return err
+		}
 	}
 
 	return e.EncodeToken(start.End())
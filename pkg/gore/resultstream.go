@@ -0,0 +1,126 @@
+package gore
+
+import (
+	"errors"
+	"sync"
+)
+
+// errStreamClosed is returned to producers when the stream has been closed
+// by the consumer before all results were read.
+var errStreamClosed = errors.New("Result stream closed")
+
+// ErrStreamActive is returned by ResultStream.Err if it is called before
+// every result has been read or the stream closed.
+var ErrStreamActive = errors.New("Result stream has not been read to the end")
+
+// ResultStream allows results to be processed one at a time as they are
+// received, rather than waiting for a complete ResultSet. Results must be
+// read by one goroutine, and the result of the query is only available once
+// Next has returned false or the stream has been closed.
+//
+//	for stream.Next() {
+//		item := stream.Item()
+//		...
+//	}
+//	if err := stream.Err(); err != nil {
+//		...
+//	}
+type ResultStream struct {
+	QueryName string
+	Schema    Schema
+
+	items     chan ResultItem
+	done      chan struct{}
+	finished  chan struct{}
+	closeOnce sync.Once
+	current   ResultItem
+	query     QueryResult
+	drained   bool
+}
+
+// NewResultStream starts produce in a new goroutine. Produce should pass
+// each result to emit and stop if emit returns an error, returning the
+// QueryResult for the query once complete.
+func NewResultStream(name string, schema Schema, produce func(emit func(ResultItem) error) QueryResult) *ResultStream {
+	rs := &ResultStream{
+		QueryName: name,
+		Schema:    schema,
+		items:     make(chan ResultItem),
+		done:      make(chan struct{}),
+		finished:  make(chan struct{}),
+	}
+	go func() {
+		defer close(rs.finished)
+		defer close(rs.items)
+		rs.query = produce(func(item ResultItem) error {
+			select {
+			case rs.items <- item:
+				return nil
+			case <-rs.done:
+				return errStreamClosed
+			}
+		})
+		if errors.Is(rs.query.Error, errStreamClosed) {
+			rs.query.Error = nil
+		}
+	}()
+	return rs
+}
+
+// Next advances to the next result, returning false once there are no
+// more results or an error has occurred.
+func (rs *ResultStream) Next() bool {
+	item, ck := <-rs.items
+	if !ck {
+		rs.drained = true
+		return false
+	}
+	rs.current = item
+	return true
+}
+
+// Item returns the current result.
+func (rs *ResultStream) Item() ResultItem {
+	return rs.current
+}
+
+// Query returns the QueryResult. It doesn't wait for the query to finish, so
+// if called before every result has been read or the stream closed the
+// Error is ErrStreamActive.
+func (rs *ResultStream) Query() QueryResult {
+	if rs.drained {
+		return rs.query
+	}
+	select {
+	case <-rs.finished:
+		return rs.query
+	default:
+		return QueryResult{Error: ErrStreamActive}
+	}
+}
+
+// Err returns the error for the query, if any. See Query.
+func (rs *ResultStream) Err() error {
+	return rs.Query().Error
+}
+
+// Close stops the stream, discarding any results not yet read.
+func (rs *ResultStream) Close() {
+	rs.closeOnce.Do(func() { close(rs.done) })
+	for range rs.items {
+	}
+	<-rs.finished
+}
+
+// Collect reads all remaining results into a ResultSet.
+func (rs *ResultStream) Collect() ResultSet {
+	set := ResultSet{QueryName: rs.QueryName, Schema: rs.Schema}
+	for rs.Next() {
+		set.Results = append(set.Results, rs.Item())
+	}
+	set.Query = rs.Query()
+	if set.Query.Error == nil && len(set.Results) == 0 {
+		set.Query.Empty = true
+	}
+	return set
+}
@@ -0,0 +1,186 @@
+package gore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testSchema = Schema{
+	{Name: "id", Type: "int", Nullable: true},
+	{Name: "name", Type: "string", Nullable: true},
+}
+
+func testItem(id int, name string) ResultItem {
+	return ResultItem{Data: map[string]interface{}{"id": id, "name": name}}
+}
+
+// itemStream returns a stream that produces items and then returns err.
+// The error returned by the last call to emit is stored in emitErr.
+func itemStream(items []ResultItem, err error, emitErr *error) *ResultStream {
+	return NewResultStream("test", testSchema, func(emit func(ResultItem) error) QueryResult {
+		qr := QueryResult{Completed: true}
+		for _, item := range items {
+			if eerr := emit(item); eerr != nil {
+				if emitErr != nil {
+					*emitErr = eerr
+				}
+				qr.Error = eerr
+				return qr
+			}
+		}
+		qr.Error = err
+		return qr
+	})
+}
+
+func TestResultStream(t *testing.T) {
+	rs := itemStream([]ResultItem{testItem(1, "a"), testItem(2, "b"), testItem(3, "c")}, nil, nil)
+	var ids []int
+	for rs.Next() {
+		ids = append(ids, rs.Item().Int("id"))
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[2] != 3 {
+		t.Errorf("Stream returned ids %v", ids)
+	}
+	if err := rs.Err(); err != nil {
+		t.Errorf("Err() = %s", err)
+	}
+	if !rs.Query().Completed {
+		t.Error("Query() was not completed")
+	}
+	if rs.Next() {
+		t.Error("Next() returned true after the stream was drained")
+	}
+}
+
+func TestResultStreamActive(t *testing.T) {
+	rs := itemStream([]ResultItem{testItem(1, "a"), testItem(2, "b")}, nil, nil)
+	if err := rs.Err(); !errors.Is(err, ErrStreamActive) {
+		t.Errorf("Err() before reading = %v, want ErrStreamActive", err)
+	}
+	if !rs.Next() {
+		t.Fatal("Next() returned false")
+	}
+	if err := rs.Err(); !errors.Is(err, ErrStreamActive) {
+		t.Errorf("Err() after one item = %v, want ErrStreamActive", err)
+	}
+	for rs.Next() {
+	}
+	if err := rs.Err(); err != nil {
+		t.Errorf("Err() once drained = %v", err)
+	}
+}
+
+func TestResultStreamCollect(t *testing.T) {
+	errFailed := errors.New("failed")
+	set := itemStream([]ResultItem{testItem(1, "a"), testItem(2, "b")}, errFailed, nil).Collect()
+	if len(set.Results) != 2 || !errors.Is(set.Query.Error, errFailed) || set.Query.Empty {
+		t.Errorf("Collect() = %d results, error %v, empty %t", len(set.Results), set.Query.Error, set.Query.Empty)
+	}
+	if set.QueryName != "test" || len(set.Schema) != len(testSchema) {
+		t.Errorf("Collect() set is %s with %d fields", set.QueryName, len(set.Schema))
+	}
+
+	set = itemStream(nil, nil, nil).Collect()
+	if len(set.Results) != 0 || set.Query.Error != nil || !set.Query.Empty {
+		t.Errorf("Collect() of an empty stream = %d results, error %v, empty %t", len(set.Results), set.Query.Error, set.Query.Empty)
+	}
+}
+
+func TestResultStreamClose(t *testing.T) {
+	var items []ResultItem
+	for i := 0; i < 100; i++ {
+		items = append(items, testItem(i, "x"))
+	}
+	var emitErr error
+	rs := itemStream(items, nil, &emitErr)
+	if !rs.Next() {
+		t.Fatal("Next() returned false")
+	}
+	closed := make(chan struct{})
+	go func() {
+		rs.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() did not return while the producer was sending")
+	}
+	if !errors.Is(emitErr, errStreamClosed) {
+		t.Errorf("Producer was told %v, want errStreamClosed", emitErr)
+	}
+	if err := rs.Err(); err != nil {
+		t.Errorf("Err() after Close = %v", err)
+	}
+	if rs.Next() {
+		t.Error("Next() returned true after Close")
+	}
+	rs.Close()
+}
+
+func TestResultStreamExport(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		xFmt string
+		want string
+	}{
+		{"csv", "id,name\n1,a\n2,b\n"},
+		{"json", `{"Results":[{"ResultItem":{"id":1,"name":"a"}},{"ResultItem":{"id":2,"name":"b"}}]}`},
+	}
+	for _, tc := range tests {
+		fn := filepath.Join(dir, "export."+tc.xFmt)
+		rs := itemStream([]ResultItem{testItem(1, "a"), testItem(2, "b")}, nil, nil)
+		if err := rs.Export(fn, tc.xFmt, ','); err != nil {
+			t.Errorf("Export(%s) returned %s", tc.xFmt, err)
+			continue
+		}
+		content, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != tc.want {
+			t.Errorf("Export(%s) wrote %q, want %q", tc.xFmt, content, tc.want)
+		}
+	}
+
+	errFailed := errors.New("failed")
+	rs := itemStream([]ResultItem{testItem(1, "a")}, errFailed, nil)
+	if err := rs.Export(filepath.Join(dir, "failed.csv"), "csv", ','); !errors.Is(err, errFailed) {
+		t.Errorf("Export of a failed stream returned %v", err)
+	}
+
+	rs = itemStream([]ResultItem{testItem(1, "a"), testItem(2, "b")}, nil, nil)
+	if err := rs.Export(filepath.Join(dir, "export.txt"), "txt", ','); err == nil {
+		t.Error("Export accepted an unknown format")
+	}
+	if err := rs.Err(); err != nil {
+		t.Errorf("Stream was not closed by a failed Export: %v", err)
+	}
+}
+
+func TestNewExporterXML(t *testing.T) {
+	var buf bytes.Buffer
+	exp, err := NewExporter(&buf, "xml", testSchema, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.Write(testItem(1, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	root, err := ParseXML(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Unable to parse the XML export %q: %s", buf.String(), err)
+	}
+	items, _ := root.GetAll("ResultItem")
+	if len(items) != 1 {
+		t.Errorf("XML export has %d items, want 1: %s", len(items), buf.String())
+	}
+}
@@ -0,0 +1,195 @@
+package gore
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Field describes a single value that may be present in a ResultItem. Key
+// fields together form the natural key for a result.
+type Field struct {
+	Name     string
+	Type     string
+	Nullable bool
+	Key      bool
+}
+
+// Schema is the list of fields a ResultSet can contain, sorted by name.
+type Schema []Field
+
+// NewSchema creates a Schema from a field map of the form used by
+// XmlNode.AsMap, i.e. "path.to.node:name" -> type. Any field can be missing
+// from a response, so every field is nullable until it is made part of the
+// key using WithKey.
+func NewSchema(fieldMap map[string]string) Schema {
+	schema := make(Schema, 0, len(fieldMap))
+	for key, typ := range fieldMap {
+		schema = append(schema, Field{Name: fieldName(key), Type: typ, Nullable: true})
+	}
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Name < schema[j].Name })
+	return schema
+}
+
+func fieldName(key string) string {
+	if strings.Contains(key, ":") {
+		return strings.SplitN(key, ":", 2)[1]
+	}
+	parts := strings.Split(key, ".")
+	return parts[len(parts)-1]
+}
+
+// Add returns a new Schema containing the additional fields.
+func (s Schema) Add(fields ...Field) Schema {
+	schema := append(append(Schema{}, s...), fields...)
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Name < schema[j].Name })
+	return schema
+}
+
+// WithKey returns a new Schema with the named fields marked as the key.
+func (s Schema) WithKey(names ...string) Schema {
+	schema := append(Schema{}, s...)
+	for i := range schema {
+		schema[i].Key = false
+		for _, name := range names {
+			if schema[i].Name == name {
+				schema[i].Key = true
+				schema[i].Nullable = false
+			}
+		}
+	}
+	return schema
+}
+
+// Key returns the names of the key fields.
+func (s Schema) Key() []string {
+	var names []string
+	for _, f := range s {
+		if f.Key {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// Field returns the Field with the given name.
+func (s Schema) Field(name string) (Field, bool) {
+	for _, f := range s {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Types returns the type of each of the named fields, or an empty string for
+// fields not in the schema.
+func (s Schema) Types(names []string) []string {
+	types := make([]string, len(names))
+	for i, name := range names {
+		if f, ck := s.Field(name); ck {
+			types[i] = f.Type
+		}
+	}
+	return types
+}
+
+// Names returns the field names in schema order.
+func (s Schema) Names() []string {
+	names := make([]string, len(s))
+	for i, f := range s {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Decode copies the results into out, which must be a pointer to a slice of
+// structs. Struct fields are matched to result fields using the "gore" tag,
+// or the struct field name if no tag is present. A tag of "-" skips the field.
+func (rs ResultSet) Decode(out interface{}) error {
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Decode requires a pointer to a slice, not %T", out)
+	}
+	slice := ptr.Elem()
+	elemType := slice.Type().Elem()
+	for n, item := range rs.Results {
+		elem := reflect.New(elemType)
+		if err := item.Decode(elem.Interface()); err != nil {
+			return fmt.Errorf("Unable to decode result %d: %w", n, err)
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	return nil
+}
+
+// Decode copies the item values into the struct pointed to by out.
+func (ri ResultItem) Decode(out interface{}) error {
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Decode requires a pointer to a struct, not %T", out)
+	}
+	st := ptr.Elem()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Type().Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Name
+		if tag, ck := sf.Tag.Lookup("gore"); ck {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		v, ck := ri.Data[name]
+		if !ck || v == nil {
+			continue
+		}
+		if err := assignValue(st.Field(i), v); err != nil {
+			return fmt.Errorf("Field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func assignValue(dst reflect.Value, v interface{}) error {
+	if dst.Kind() == reflect.Ptr {
+		nv := reflect.New(dst.Type().Elem())
+		if err := assignValue(nv.Elem(), v); err != nil {
+			return err
+		}
+		dst.Set(nv)
+		return nil
+	}
+	src := reflect.ValueOf(v)
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+	if dst.Kind() == reflect.String {
+		if tm, ck := v.(time.Time); ck {
+			dst.SetString(tm.Format(time.RFC3339))
+			return nil
+		}
+		dst.SetString(fmt.Sprintf("%v", v))
+		return nil
+	}
+	if isNumeric(src.Kind()) && isNumeric(dst.Kind()) {
+		dst.Set(src.Convert(dst.Type()))
+		return nil
+	}
+	return fmt.Errorf("cannot assign %T to %s", v, dst.Type())
+}
+
+func isNumeric(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package gore
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata"
+)
+
+// SettlementPeriodLength is the duration of a single settlement period.
+const SettlementPeriodLength = 30 * time.Minute
+
+var londonLocation = loadLocation("Europe/London")
+
+func loadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to load the %s timezone: %s", name, err))
+	}
+	return loc
+}
+
+// London returns the Europe/London location used for settlement dates.
+func London() *time.Location {
+	return londonLocation
+}
+
+// settlementDayStart returns the instant the settlement day containing the
+// calendar date of sd begins. Only the year, month and day of sd are used.
+func settlementDayStart(sd time.Time) time.Time {
+	y, m, d := sd.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, London())
+}
+
+// SettlementPeriods returns the number of settlement periods for the date,
+// which is 46 when the clocks go forward, 50 when they go back and 48 on all
+// other days.
+func SettlementPeriods(sd time.Time) int {
+	start := settlementDayStart(sd)
+	y, m, d := sd.Date()
+	end := time.Date(y, m, d+1, 0, 0, 0, 0, London())
+	return int(end.Sub(start) / SettlementPeriodLength)
+}
+
+// ValidSettlementPeriod returns an error if period is not valid for the date.
+func ValidSettlementPeriod(sd time.Time, period int) error {
+	if n := SettlementPeriods(sd); period < 1 || period > n {
+		return fmt.Errorf("Settlement Period for %s must be between 1 and %d - not %d", sd.Format("2006-01-02"), n, period)
+	}
+	return nil
+}
+
+// SettlementPeriodTimes returns the UTC start and end of the settlement period.
+func SettlementPeriodTimes(sd time.Time, period int) (start, end time.Time, err error) {
+	if err = ValidSettlementPeriod(sd, period); err != nil {
+		return
+	}
+	start = settlementDayStart(sd).UTC().Add(time.Duration(period-1) * SettlementPeriodLength)
+	end = start.Add(SettlementPeriodLength)
+	return
+}
+
+// SettlementPeriodFor returns the settlement date and period that contain t.
+// The date returned is midnight UTC on the settlement day, matching the
+// values parsed from Elexon responses.
+func SettlementPeriodFor(t time.Time) (sd time.Time, period int) {
+	local := t.In(London())
+	y, m, d := local.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, London())
+	period = int(t.Sub(start)/SettlementPeriodLength) + 1
+	sd = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return
+}
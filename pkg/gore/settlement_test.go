@@ -0,0 +1,139 @@
+package gore
+
+import (
+	"testing"
+	"time"
+)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func utcTime(y int, m time.Month, d, hh, mm int) time.Time {
+	return time.Date(y, m, d, hh, mm, 0, 0, time.UTC)
+}
+
+func TestSettlementPeriods(t *testing.T) {
+	tests := []struct {
+		sd   time.Time
+		want int
+	}{
+		{day(2022, time.March, 26), 48},
+		{day(2022, time.March, 27), 46},
+		{day(2022, time.March, 28), 48},
+		{day(2022, time.October, 29), 48},
+		{day(2022, time.October, 30), 50},
+		{day(2022, time.October, 31), 48},
+		{day(2023, time.March, 26), 46},
+		{day(2023, time.October, 29), 50},
+		{day(2022, time.June, 21), 48},
+	}
+	for _, tc := range tests {
+		if got := SettlementPeriods(tc.sd); got != tc.want {
+			t.Errorf("SettlementPeriods(%s) = %d, want %d", tc.sd.Format("2006-01-02"), got, tc.want)
+		}
+	}
+}
+
+func TestValidSettlementPeriod(t *testing.T) {
+	tests := []struct {
+		sd     time.Time
+		period int
+		valid  bool
+	}{
+		{day(2022, time.March, 27), 0, false},
+		{day(2022, time.March, 27), 1, true},
+		{day(2022, time.March, 27), 46, true},
+		{day(2022, time.March, 27), 47, false},
+		{day(2022, time.June, 21), 48, true},
+		{day(2022, time.June, 21), 49, false},
+		{day(2022, time.October, 30), 50, true},
+		{day(2022, time.October, 30), 51, false},
+	}
+	for _, tc := range tests {
+		err := ValidSettlementPeriod(tc.sd, tc.period)
+		if (err == nil) != tc.valid {
+			t.Errorf("ValidSettlementPeriod(%s, %d) = %v, want valid %t", tc.sd.Format("2006-01-02"), tc.period, err, tc.valid)
+		}
+	}
+}
+
+func TestSettlementPeriodTimes(t *testing.T) {
+	tests := []struct {
+		sd     time.Time
+		period int
+		start  time.Time
+	}{
+		// Winter days start at midnight UTC.
+		{day(2022, time.January, 10), 1, utcTime(2022, time.January, 10, 0, 0)},
+		{day(2022, time.January, 10), 48, utcTime(2022, time.January, 10, 23, 30)},
+		// Summer days start at 23:00 UTC the day before.
+		{day(2022, time.June, 21), 1, utcTime(2022, time.June, 20, 23, 0)},
+		{day(2022, time.June, 21), 48, utcTime(2022, time.June, 21, 22, 30)},
+		// Clocks go forward at 01:00 UTC, so period 3 follows period 2.
+		{day(2022, time.March, 27), 1, utcTime(2022, time.March, 27, 0, 0)},
+		{day(2022, time.March, 27), 2, utcTime(2022, time.March, 27, 0, 30)},
+		{day(2022, time.March, 27), 3, utcTime(2022, time.March, 27, 1, 0)},
+		{day(2022, time.March, 27), 46, utcTime(2022, time.March, 27, 22, 30)},
+		// Clocks go back at 01:00 UTC, so 01:00 - 02:00 local time is
+		// covered by periods 3 and 4 and again by 5 and 6.
+		{day(2022, time.October, 30), 1, utcTime(2022, time.October, 29, 23, 0)},
+		{day(2022, time.October, 30), 4, utcTime(2022, time.October, 30, 0, 30)},
+		{day(2022, time.October, 30), 5, utcTime(2022, time.October, 30, 1, 0)},
+		{day(2022, time.October, 30), 50, utcTime(2022, time.October, 30, 23, 30)},
+	}
+	for _, tc := range tests {
+		start, end, err := SettlementPeriodTimes(tc.sd, tc.period)
+		if err != nil {
+			t.Errorf("SettlementPeriodTimes(%s, %d) returned %s", tc.sd.Format("2006-01-02"), tc.period, err)
+			continue
+		}
+		if !start.Equal(tc.start) || !end.Equal(tc.start.Add(SettlementPeriodLength)) {
+			t.Errorf("SettlementPeriodTimes(%s, %d) = %s - %s, want start %s", tc.sd.Format("2006-01-02"), tc.period, start, end, tc.start)
+		}
+	}
+	if _, _, err := SettlementPeriodTimes(day(2022, time.March, 27), 47); err == nil {
+		t.Error("SettlementPeriodTimes accepted period 47 on a 46 period day")
+	}
+}
+
+func TestSettlementPeriodFor(t *testing.T) {
+	tests := []struct {
+		t      time.Time
+		sd     time.Time
+		period int
+	}{
+		{utcTime(2022, time.March, 26, 23, 59), day(2022, time.March, 26), 48},
+		{utcTime(2022, time.March, 27, 0, 59), day(2022, time.March, 27), 2},
+		{utcTime(2022, time.March, 27, 1, 0), day(2022, time.March, 27), 3},
+		{utcTime(2022, time.March, 27, 22, 59), day(2022, time.March, 27), 46},
+		{utcTime(2022, time.March, 27, 23, 0), day(2022, time.March, 28), 1},
+		{utcTime(2022, time.October, 29, 22, 59), day(2022, time.October, 29), 48},
+		{utcTime(2022, time.October, 29, 23, 0), day(2022, time.October, 30), 1},
+		{utcTime(2022, time.October, 30, 0, 30), day(2022, time.October, 30), 4},
+		{utcTime(2022, time.October, 30, 1, 30), day(2022, time.October, 30), 6},
+		{utcTime(2022, time.October, 30, 23, 59), day(2022, time.October, 30), 50},
+		{utcTime(2022, time.October, 31, 0, 0), day(2022, time.October, 31), 1},
+	}
+	for _, tc := range tests {
+		sd, period := SettlementPeriodFor(tc.t)
+		if !sd.Equal(tc.sd) || period != tc.period {
+			t.Errorf("SettlementPeriodFor(%s) = %s period %d, want %s period %d", tc.t, sd.Format("2006-01-02"), period, tc.sd.Format("2006-01-02"), tc.period)
+		}
+	}
+}
+
+func TestSettlementPeriodRoundTrip(t *testing.T) {
+	for _, sd := range []time.Time{day(2022, time.March, 27), day(2022, time.October, 30), day(2023, time.March, 26), day(2023, time.October, 29)} {
+		for period := 1; period <= SettlementPeriods(sd); period++ {
+			start, _, err := SettlementPeriodTimes(sd, period)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotSd, gotPeriod := SettlementPeriodFor(start)
+			if !gotSd.Equal(sd) || gotPeriod != period {
+				t.Errorf("%s period %d starts at %s, which is %s period %d", sd.Format("2006-01-02"), period, start, gotSd.Format("2006-01-02"), gotPeriod)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package gore
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+)
+
+// StreamCache is implemented by caches that can read and store content as a
+// stream, so large responses are never held in memory.
+type StreamCache interface {
+	Cache
+	Open(key string, ttl time.Duration) (io.ReadCloser, bool)
+	PutFrom(key string, r io.Reader) error
+}
+
+// StreamCapturer is implemented by capturers that can capture content from a
+// reader.
+type StreamCapturer interface {
+	Capturer
+	CaptureFrom(name string, r io.Reader) error
+}
+
+// OpenCached returns a reader for the content cached for key, streaming it
+// if the cache is a StreamCache. The caller must close it.
+func OpenCached(c Cache, key string, ttl time.Duration) (io.ReadCloser, bool) {
+	if sc, ck := c.(StreamCache); ck {
+		return sc.Open(key, ttl)
+	}
+	content, ck := c.Get(key, ttl)
+	if !ck {
+		return nil, false
+	}
+	return io.NopCloser(bytes.NewReader(content)), true
+}
+
+// Spool keeps a copy of everything written to it in a temporary file, so a
+// response can be cached or captured once it has been read without holding
+// it in memory. It is normally used with io.TeeReader.
+type Spool struct {
+	f *os.File
+}
+
+// NewSpool creates a Spool. Close must be called to remove the file.
+func NewSpool() (*Spool, error) {
+	f, err := os.CreateTemp("", "gore-*.spool")
+	if err != nil {
+		return nil, err
+	}
+	return &Spool{f: f}, nil
+}
+
+func (s *Spool) Write(p []byte) (int, error) {
+	return s.f.Write(p)
+}
+
+// reader returns a reader for everything written so far.
+func (s *Spool) reader() (io.Reader, error) {
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return s.f, nil
+}
+
+// Cache stores the content of the spool in c using key.
+func (s *Spool) Cache(c Cache, key string) error {
+	rdr, err := s.reader()
+	if err != nil {
+		return err
+	}
+	if sc, ck := c.(StreamCache); ck {
+		return sc.PutFrom(key, rdr)
+	}
+	content, err := io.ReadAll(rdr)
+	if err != nil {
+		return err
+	}
+	return c.Put(key, content)
+}
+
+// Capture passes the content of the spool to c.
+func (s *Spool) Capture(c Capturer, name string) error {
+	rdr, err := s.reader()
+	if err != nil {
+		return err
+	}
+	if sc, ck := c.(StreamCapturer); ck {
+		return sc.CaptureFrom(name, rdr)
+	}
+	content, err := io.ReadAll(rdr)
+	if err != nil {
+		return err
+	}
+	return c.Capture(name, content)
+}
+
+// Close removes the temporary file.
+func (s *Spool) Close() error {
+	err := s.f.Close()
+	if rerr := os.Remove(s.f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
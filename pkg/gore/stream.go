@@ -0,0 +1,73 @@
+package gore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// XMLStream decodes an XML document one token at a time, passing each
+// element found at a registered path to its handler as an XmlNode. Only
+// the elements being handled are held in memory, so large documents can
+// be processed in constant memory.
+type XMLStream struct {
+	dec      *xml.Decoder
+	handlers map[string]func(XmlNode) error
+}
+
+// NewXMLStream returns an XMLStream that will read from r.
+func NewXMLStream(r io.Reader) *XMLStream {
+	return &XMLStream{dec: xml.NewDecoder(r), handlers: make(map[string]func(XmlNode) error)}
+}
+
+// Handle registers fn to be called for every element at path. As with
+// XmlNode.Get, the path is relative to the root element and uses "." to
+// separate element names, e.g. "responseBody.responseList.item".
+func (xs *XMLStream) Handle(path string, fn func(XmlNode) error) {
+	xs.handlers[path] = fn
+}
+
+// Run processes the document. Any error returned by a handler stops
+// processing and is returned.
+func (xs *XMLStream) Run() error {
+	var stack []string
+	seenRoot := false
+	for {
+		tok, err := xs.dec.Token()
+		if err == io.EOF {
+			if !seenRoot {
+				return fmt.Errorf("Cannot parse empty content: %w", ErrEmpty)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrParse, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if !seenRoot {
+				seenRoot = true
+				stack = append(stack, t.Name.Local)
+				continue
+			}
+			path := strings.Join(append(stack[1:len(stack):len(stack)], t.Name.Local), ".")
+			fn, ck := xs.handlers[path]
+			if !ck {
+				stack = append(stack, t.Name.Local)
+				continue
+			}
+			var node XmlNode
+			if err := xs.dec.DecodeElement(&node, &t); err != nil {
+				return fmt.Errorf("%w: %s", ErrParse, err)
+			}
+			if err := fn(node); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package gore
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testStreamXML = `<response>
+	<responseMetadata><httpCode>200</httpCode></responseMetadata>
+	<responseBody>
+		<responseList>
+			<item><id>1</id></item>
+			<item><id>2</id><item><id>nested</id></item></item>
+			<other><item><id>3</id></item></other>
+		</responseList>
+	</responseBody>
+	<item><id>4</id></item>
+</response>`
+
+func TestXMLStreamPaths(t *testing.T) {
+	xs := NewXMLStream(strings.NewReader(testStreamXML))
+	var codes, ids, topIDs []string
+	xs.Handle("responseMetadata", func(node XmlNode) error {
+		code, err := node.Get("httpCode")
+		codes = append(codes, string(code.Content))
+		return err
+	})
+	xs.Handle("responseBody.responseList.item", func(node XmlNode) error {
+		id, err := node.Get("id")
+		ids = append(ids, string(id.Content))
+		return err
+	})
+	xs.Handle("item", func(node XmlNode) error {
+		id, err := node.Get("id")
+		topIDs = append(topIDs, string(id.Content))
+		return err
+	})
+	if err := xs.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(codes, []string{"200"}) {
+		t.Errorf("responseMetadata handled %v", codes)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("responseBody.responseList.item handled %v, want [1 2]", ids)
+	}
+	if !reflect.DeepEqual(topIDs, []string{"4"}) {
+		t.Errorf("item handled %v, want [4]", topIDs)
+	}
+}
+
+func TestXMLStreamHandlerError(t *testing.T) {
+	errStop := errors.New("stop")
+	xs := NewXMLStream(strings.NewReader(testStreamXML))
+	count := 0
+	xs.Handle("responseBody.responseList.item", func(node XmlNode) error {
+		count++
+		return errStop
+	})
+	if err := xs.Run(); !errors.Is(err, errStop) {
+		t.Errorf("Run() = %v, want the handler error", err)
+	}
+	if count != 1 {
+		t.Errorf("Handler was called %d times after returning an error", count)
+	}
+}
+
+func TestXMLStreamErrors(t *testing.T) {
+	for _, content := range []string{"", "  \n"} {
+		if err := NewXMLStream(strings.NewReader(content)).Run(); !errors.Is(err, ErrEmpty) {
+			t.Errorf("Run() of %q = %v, want ErrEmpty", content, err)
+		}
+	}
+	if err := NewXMLStream(strings.NewReader("<response><item>")).Run(); !errors.Is(err, ErrParse) {
+		t.Errorf("Run() of a truncated document = %v, want ErrParse", err)
+	}
+}
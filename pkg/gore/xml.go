@@ -19,11 +19,13 @@ type XmlNode struct {
 
 func ParseXML(content []byte) (nodes XmlNode, err error) {
 	if len(content) == 0 {
-		err = fmt.Errorf("Cannot parse empty content!")
+		err = fmt.Errorf("Cannot parse empty content: %w", ErrEmpty)
 		return
 	}
 	dec := xml.NewDecoder(bytes.NewReader(content))
-	err = dec.Decode(&nodes)
+	if err = dec.Decode(&nodes); err != nil {
+		err = fmt.Errorf("%w: %s", ErrParse, err)
+	}
 	return
 }
 
@@ -78,11 +80,14 @@ func (n XmlNode) GetAsMap(name string, mapInfo map[string]string) (info map[stri
 	return
 }
 
+// AsMap returns the values of the child nodes given in mapInfo converted to
+// their types. Fields that are not present are included as null.
 func (n XmlNode) AsMap(mapInfo map[string]string) (info map[string]interface{}) {
 	info = make(map[string]interface{})
 	for key, typ := range mapInfo {
 		node, err := n.Get(key)
 		if err != nil {
+			info[fieldName(key)] = nil
 			continue
 		}
 		if strings.Contains(key, ":") {
@@ -101,16 +106,16 @@ func attrMatch(name string, mapName string) bool {
 	return strings.SplitN(mapName, ":", 2)[0] == name
 }
 
+// AttrAsMap returns the values of the attributes given in mapInfo converted
+// to their types. Fields that are not present are included as null.
 func (n XmlNode) AttrAsMap(mapInfo map[string]string) (info map[string]interface{}) {
 	info = make(map[string]interface{})
 	for _, attr := range n.Attr {
 		var final string
 		var attrType string
-		for final, attrType = range mapInfo {
-			if attrMatch(attr.Name.Local, final) {
-				if strings.Contains(final, ":") {
-					final = strings.SplitN(final, ":", 2)[1]
-				}
+		for key, typ := range mapInfo {
+			if attrMatch(attr.Name.Local, key) {
+				final, attrType = fieldName(key), typ
 				break
 			}
 		}
@@ -120,16 +125,30 @@ func (n XmlNode) AttrAsMap(mapInfo map[string]string) (info map[string]interface
 		}
 		info[final] = convert(string(attr.Value), attrType)
 	}
+	for key := range mapInfo {
+		if _, ck := info[fieldName(key)]; !ck {
+			info[fieldName(key)] = nil
+		}
+	}
 	return
 }
 
+// IsNullValue returns true if the string represents a missing value.
+func IsNullValue(cStr string) bool {
+	return cStr == "" || cStr == "NULL"
+}
+
+// convert returns the value of cStr as type t. "NULL", and for types other
+// than string an empty value, is returned as nil, which is treated as a null
+// value. Values that cannot be converted are logged and also returned as
+// nil, so every value has the type given by the schema.
 func convert(cStr string, t string) (rv interface{}) {
+	trimmed := strings.TrimSpace(cStr)
+	if trimmed == "NULL" || t != "string" && IsNullValue(trimmed) {
+		return nil
+	}
 	switch t {
 	case "int":
-		if cStr == "NULL" {
-			rv = 0
-			break
-		}
 		num, err := strconv.Atoi(cStr)
 		if err == nil {
 			rv = num
@@ -137,10 +156,6 @@ func convert(cStr string, t string) (rv interface{}) {
 			log.Printf("Unable to convert %s to an int", cStr)
 		}
 	case "float":
-		if cStr == "NULL" {
-			rv = 0.0
-			break
-		}
 		num, err := strconv.ParseFloat(cStr, 64)
 		if err == nil {
 			rv = num
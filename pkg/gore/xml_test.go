@@ -0,0 +1,112 @@
+package gore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		value string
+		typ   string
+		want  interface{}
+	}{
+		{"42", "int", 42},
+		{"", "int", nil},
+		{"NULL", "int", nil},
+		{"4.2x", "int", nil},
+		{"1.5", "float", 1.5},
+		{" NULL ", "float", nil},
+		{"abc", "float", nil},
+		{"Yes", "bool", true},
+		{"No", "bool", false},
+		{"NULL", "bool", nil},
+		{"Wind", "string", "Wind"},
+		{"", "string", ""},
+		{"NULL", "string", nil},
+		{"a\rb", "string", "a, b"},
+		{"2022-05-01", "date", day(2022, 5, 1)},
+		{"01/05/2022", "date", day(2022, 5, 1)},
+		{"2022-13-01", "date", nil},
+		{"NULL", "date", nil},
+		{"2022-05-01T10:30:00", "dateTime", utcTime(2022, 5, 1, 10, 30)},
+		{"2022-05-01 10:30:00", "dateTime", utcTime(2022, 5, 1, 10, 30)},
+		{"01/05/2022 10:30:00", "dateTime", utcTime(2022, 5, 1, 10, 30)},
+		{"tomorrow", "dateTime", nil},
+	}
+	for _, tc := range tests {
+		if got := convert(tc.value, tc.typ); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("convert(%q, %s) = %#v, want %#v", tc.value, tc.typ, got, tc.want)
+		}
+	}
+}
+
+const testXML = `<response>
+	<item>
+		<bmUnitID>T_ABC-1</bmUnitID>
+		<level>NULL</level>
+		<flag>bad</flag>
+		<period><start>2022-05-01</start></period>
+		<row id="7" name="NULL" quantity="1.5" extra="x"/>
+	</item>
+</response>`
+
+func TestAsMap(t *testing.T) {
+	root, err := ParseXML([]byte(testXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := root.GetAsMap("item", map[string]string{
+		"bmUnitID":     "string",
+		"level":        "int",
+		"flag:active":  "int",
+		"period.start": "date",
+		"missing":      "float",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"bmUnitID": "T_ABC-1",
+		"level":    nil,
+		"active":   nil,
+		"start":    day(2022, 5, 1),
+		"missing":  nil,
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("GetAsMap = %v, want %v", info, want)
+	}
+
+	if _, err := root.GetAsMap("nothing", map[string]string{"level": "int"}); err == nil {
+		t.Error("GetAsMap did not return an error for a missing node")
+	}
+	if _, err := ParseXML(nil); err == nil {
+		t.Error("ParseXML accepted empty content")
+	}
+}
+
+func TestAttrAsMap(t *testing.T) {
+	root, err := ParseXML([]byte(testXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := root.Get("item.row")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := row.AttrAsMap(map[string]string{
+		"id":              "int",
+		"name":            "string",
+		"quantity:volume": "float",
+		"missing":         "date",
+	})
+	want := map[string]interface{}{
+		"id":      7,
+		"name":    nil,
+		"volume":  1.5,
+		"missing": nil,
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("AttrAsMap = %v, want %v", info, want)
+	}
+}
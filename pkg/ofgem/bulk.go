@@ -0,0 +1,164 @@
+package ofgem
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// PeriodError records a month of a CertificateDownload that failed or
+// whose results are incomplete.
+type PeriodError struct {
+	Period time.Time
+	Err    error
+}
+
+func (pe PeriodError) Error() string {
+	return fmt.Sprintf("%s: %s", pe.Period.Format("Jan-2006"), pe.Err)
+}
+
+func (pe PeriodError) Unwrap() error {
+	return pe.Err
+}
+
+// CertificateDownload gets the certificates for a range of output periods
+// one month at a time, using a pool of workers that each have their own
+// session with the Ofgem site.
+type CertificateDownload struct {
+	// Concurrency is the number of months that can be searched at once.
+	Concurrency int
+	// Filter, if set, is called to set any other filters on the search for
+	// each month.
+	Filter  func(*CertificateSearch) error
+	Capture gore.Capturer
+	Cache   gore.Cache
+}
+
+// GetMonths gets the certificates for every output period from the month of
+// from to the month of to (inclusive), returning them ordered by output
+// period. Months that failed, or whose results are incomplete, are returned
+// with the error for each. If every month fails then Query.Error is also set.
+func (cd *CertificateDownload) GetMonths(ctx context.Context, from, to time.Time) (gore.ResultSet, []PeriodError) {
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if last.Before(first) {
+		result := gore.ResultSet{QueryName: "certificatesearch", Schema: certSchema}
+		result.Query.Error = fmt.Errorf("The end of the range (%s) is before the start (%s)", last.Format("Jan-2006"), first.Format("Jan-2006"))
+		return result, nil
+	}
+	var months []time.Time
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		months = append(months, month)
+	}
+
+	workers := cd.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]gore.ResultSet, len(months))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var client *Client
+			for n := range jobs {
+				if ctx.Err() != nil {
+					results[n].Query.Error = ctx.Err()
+					continue
+				}
+				if client == nil {
+					c, err := NewClient()
+					if err != nil {
+						results[n].Query.Error = err
+						continue
+					}
+					client = c
+				}
+				results[n] = cd.getMonth(client, months[n])
+			}
+		}()
+	}
+	for n := range months {
+		jobs <- n
+	}
+	close(jobs)
+	wg.Wait()
+
+	m := newCertificateMerger()
+	var failures []PeriodError
+	for n, rs := range results {
+		if rs.Query.Error != nil || rs.Query.Capped {
+			failures = append(failures, PeriodError{months[n], rs.Query.Err()})
+		}
+		if rs.Query.Capped {
+			// Keep the results found, the month is reported as a failure.
+			rs.Query.Error = nil
+		}
+		if rs.Query.Error == nil {
+			m.add(rs)
+		}
+	}
+	result := m.finish()
+	sortByOutputPeriod(result.Results)
+	if !result.Query.Completed && len(failures) > 0 {
+		result.Query.Error = failures[0]
+		result.Query.Empty = false
+	}
+	return result, failures
+}
+
+// sortByOutputPeriod sorts certificate search results by the start of the
+// output period given by their certificate numbers. The sort is stable and
+// results whose numbers can't be parsed are kept after the result before
+// them.
+func sortByOutputPeriod(items []gore.ResultItem) {
+	periods := make([]time.Time, len(items))
+	var last time.Time
+	for n, item := range items {
+		if r, err := ItemCertificateRange(item); err == nil {
+			last = r.Start.PeriodStart
+		}
+		periods[n] = last
+	}
+	order := make([]int, len(items))
+	for n := range order {
+		order[n] = n
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return periods[order[i]].Before(periods[order[j]])
+	})
+	sorted := make([]gore.ResultItem, len(items))
+	for n, o := range order {
+		sorted[n] = items[o]
+	}
+	copy(items, sorted)
+}
+
+func (cd *CertificateDownload) getMonth(client *Client, month time.Time) (result gore.ResultSet) {
+	log.Printf("Getting certificates for %s", month.Format("Jan-2006"))
+	cs, err := client.NewCertificateSearch()
+	if err != nil {
+		result.Query.Error = err
+		return
+	}
+	cs.SetCapture(cd.Capture)
+	cs.SetCache(cd.Cache)
+	if cd.Filter != nil {
+		if err := cd.Filter(cs); err != nil {
+			result.Query.Error = err
+			return
+		}
+	}
+	if err := cs.SetPeriod(int(month.Month()), month.Year()); err != nil {
+		result.Query.Error = err
+		return
+	}
+	return cs.GetAllResults()
+}
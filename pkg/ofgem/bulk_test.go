@@ -0,0 +1,36 @@
+package ofgem
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// periodItem returns a certificate search result for certificate seq of
+// the given month of 2020.
+func periodItem(seq, month int) gore.ResultItem {
+	number := fmt.Sprintf("G00039NWEN%010d01%02d2028%02d20", seq, month, month)
+	return gore.ResultItem{Data: map[string]interface{}{"StartCertificateNo": number, "EndCertificateNo": number}}
+}
+
+func TestSortByOutputPeriod(t *testing.T) {
+	bad := gore.ResultItem{Data: map[string]interface{}{"StartCertificateNo": "bad"}}
+	items := []gore.ResultItem{periodItem(1, 5), bad, periodItem(2, 4), periodItem(3, 5), periodItem(4, 4)}
+	sortByOutputPeriod(items)
+	var got []string
+	for _, item := range items {
+		got = append(got, item.String("StartCertificateNo"))
+	}
+	want := []string{
+		periodItem(2, 4).String("StartCertificateNo"),
+		periodItem(4, 4).String("StartCertificateNo"),
+		periodItem(1, 5).String("StartCertificateNo"),
+		"bad",
+		periodItem(3, 5).String("StartCertificateNo"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortByOutputPeriod = %v, want %v", got, want)
+	}
+}
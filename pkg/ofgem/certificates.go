@@ -2,17 +2,27 @@ package ofgem
 
 import (
 	"fmt"
-	"io/ioutil"
 	"strings"
 	"time"
 
 	"github.com/zathras777/gore/pkg/gore"
 )
 
+// CertificateSearch searches the certificates issued using the Ofgem
+// certificate report.
 type CertificateSearch struct {
-	form *form
+	*Report
+	toYear  int
+	toMonth int
 }
 
+// certCacheTTL is used for cached exports. Certificates for an output period
+// are rarely issued or changed once certIssueMonths have passed since it
+// ended, so only then is the Past TTL used.
+var certCacheTTL = gore.CacheTTL{Past: 30 * 24 * time.Hour, Current: 6 * time.Hour}
+
+const certIssueMonths = 3
+
 var certAttrMap = map[string]string{
 	"textbox4:AccreditationNumber":            "string",
 	"textbox13:Station":                       "string",
@@ -33,89 +43,200 @@ var certAttrMap = map[string]string{
 	"textbox45:CompanyRegistrationNumber":     "string",
 }
 
-func NewCertificateSearch() *CertificateSearch {
-	return &CertificateSearch{
-		form: newForm("ReportViewer.aspx?ReportPath=/DatawarehouseReports/CertificatesExternalPublicDataWarehouse&ReportVisibility=1&ReportCategory=2"),
+var certSchema = gore.NewSchema(certAttrMap).Add(gore.Field{Name: "MWh", Type: "float", Nullable: true}).WithKey("StartCertificateNo")
+
+// NewCertificateSearch creates a certificate search using a new session.
+// Use a Client to share a session between searches.
+func NewCertificateSearch() (*CertificateSearch, error) {
+	c, err := NewClient()
+	if err != nil {
+		return nil, err
 	}
+	return c.NewCertificateSearch()
 }
 
-func (cs *CertificateSearch) Debug(onoff bool) {
-	cs.form.debugDelta = onoff
+// SetYear searches for certificates with an output period in year.
+func (cs *CertificateSearch) SetYear(year int) error {
+	if err := cs.SetYearFrom(year); err != nil {
+		return err
+	}
+	return cs.SetYearTo(year)
 }
 
-func (cs *CertificateSearch) SetYear(year int) error {
-	if err := cs.form.setValueByLabel("Output Period \"Year From\":", fmt.Sprintf("%d", year)); err != nil {
+// SetMonth sets both the first and last month of the output periods
+// searched.
+func (cs *CertificateSearch) SetMonth(month int) error {
+	if err := cs.SetMonthFrom(month); err != nil {
 		return err
 	}
-	if err := cs.form.setValueByLabel("Output Period \"Year To\":", fmt.Sprintf("%d", year)); err != nil {
+	return cs.SetMonthTo(month)
+}
+
+// SetPeriod searches for certificates with an output period of the given
+// month and year.
+func (cs *CertificateSearch) SetPeriod(month, year int) error {
+	if err := cs.SetMonth(month); err != nil {
 		return err
 	}
-	return nil
+	return cs.SetYear(year)
 }
 
-func (cs *CertificateSearch) SetMonth(month int) error {
-	if err := cs.form.setValueByLabel("Output Period \"Month From\":", time.Month(month).String()[:3]); err != nil {
+// SetPeriodFrom sets the start of the output periods searched.
+func (cs *CertificateSearch) SetPeriodFrom(month, year int) error {
+	if err := cs.SetMonthFrom(month); err != nil {
 		return err
 	}
-	if err := cs.form.setValueByLabel("Output Period \"Month To\":", time.Month(month).String()[:3]); err != nil {
+	return cs.SetYearFrom(year)
+}
+
+// SetPeriodTo sets the end of the output periods searched.
+func (cs *CertificateSearch) SetPeriodTo(month, year int) error {
+	if err := cs.SetMonthTo(month); err != nil {
+		return err
+	}
+	return cs.SetYearTo(year)
+}
+
+func (cs *CertificateSearch) SetYearFrom(year int) error {
+	return cs.form.setValueByLabel("Output Period \"Year From\":", fmt.Sprintf("%d", year))
+}
+
+func (cs *CertificateSearch) SetYearTo(year int) error {
+	if err := cs.form.setValueByLabel("Output Period \"Year To\":", fmt.Sprintf("%d", year)); err != nil {
 		return err
 	}
+	cs.toYear = year
 	return nil
 }
 
-func (cs *CertificateSearch) SetPeriod(month, year int) error {
-	if err := cs.SetMonth(month); err != nil {
+func (cs *CertificateSearch) SetMonthFrom(month int) error {
+	if month < 1 || month > 12 {
+		return fmt.Errorf("Month must be between 1 and 12 - not %d", month)
+	}
+	return cs.form.setValueByLabel("Output Period \"Month From\":", time.Month(month).String()[:3])
+}
+
+func (cs *CertificateSearch) SetMonthTo(month int) error {
+	if month < 1 || month > 12 {
+		return fmt.Errorf("Month must be between 1 and 12 - not %d", month)
+	}
+	if err := cs.form.setValueByLabel("Output Period \"Month To\":", time.Month(month).String()[:3]); err != nil {
 		return err
 	}
-	return cs.SetYear(year)
+	cs.toMonth = month
+	return nil
 }
 
+// Scheme limits the search to a comma separated list of schemes, e.g.
+// "RO, REGO", or "*" for all schemes.
 func (cs *CertificateSearch) Scheme(schemes string) error {
-	return cs.form.setValueByLabel("Scheme:", strings.ToUpper(schemes))
+	return cs.form.setValueByLabel("Scheme:", schemes)
 }
 
+// Countries limits the search to a comma separated list of countries.
 func (cs *CertificateSearch) Countries(countries string) error {
 	return cs.form.setValueByLabel("Country:", countries)
 }
 
-func (cs *CertificateSearch) GetResults() (result gore.ResultSet) {
-	result.QueryName = "certificatesearch"
-	if err := cs.form.Submit("ReportViewer$ctl09$Reserved_AsyncLoadTarget"); err != nil {
-		result.Query.Error = err
-		return
-	}
-	if !cs.form.ExportAvailable() {
-		result.Query.Error = fmt.Errorf("Unable to retrieve data as no export URL available")
-		return
+// AccreditationNumber limits the search to a single station.
+func (cs *CertificateSearch) AccreditationNumber(accno string) error {
+	return cs.form.setValueByLabel("Accreditation No:", accno)
+}
+
+// StationName limits the search to stations whose name matches name.
+func (cs *CertificateSearch) StationName(name string) error {
+	return cs.form.setValueByLabel("Generating Station:", name)
+}
+
+// TechnologyGroups limits the search to a comma separated list of
+// technology groups, e.g. "Wind, Hydro".
+func (cs *CertificateSearch) TechnologyGroups(groups string) error {
+	return cs.form.setValueByLabel("Technology Group:", groups)
+}
+
+// GenerationTypes limits the search to a comma separated list of
+// generation types.
+func (cs *CertificateSearch) GenerationTypes(types string) error {
+	return cs.form.setValueByLabel("Generation Type:", types)
+}
+
+// CertificateStatus limits the search to a comma separated list of
+// certificate statuses, e.g. "Issued, Redeemed".
+func (cs *CertificateSearch) CertificateStatus(statuses string) error {
+	return cs.form.setValueByLabel("Certificate Status:", statuses)
+}
+
+// CurrentHolder limits the search to certificates held by the organisation.
+func (cs *CertificateSearch) CurrentHolder(org string) error {
+	return cs.form.setValueByLabel("Current Holder Organisation Name:", org)
+}
+
+// periodEnd returns the last day of the output periods searched, or a zero
+// time if no end year has been set.
+func (cs *CertificateSearch) periodEnd() time.Time {
+	if cs.toYear == 0 {
+		return time.Time{}
 	}
-	data, err := cs.form.getData("XML")
-	if err != nil {
-		result.Query.Error = err
-		return
+	if cs.toMonth == 0 {
+		return time.Date(cs.toYear, time.December, 31, 0, 0, 0, 0, time.UTC)
 	}
-	result.Query.Completed = true
-	ioutil.WriteFile("cert_data.xml", data, 0644)
-	xmlData, err := gore.ParseXML(data)
-	if err != nil {
-		result.Query.Error = err
-		return
-	}
-	details, err := xmlData.GetAll("table1.Detail_Collection.Detail")
-	for _, detail := range details {
-		info := detail.AttrAsMap(certAttrMap)
-		info["MWh"] = float64(info["NoOfCertificates"].(int)) * info["MWhPerCertificate"].(float64)
-		if strings.Contains(info["OutputPeriod"].(string), "-") {
-			// Change 01/02/2022 - 28/02/2022 into Feb-2022
-			dtStr := strings.SplitN(info["OutputPeriod"].(string), " - ", 2)[0]
-			dt, err := time.Parse("02/01/2006", dtStr)
-			if err == nil {
-				info["OutputPeriod"] = fmt.Sprintf("%s-%d", dt.Month().String()[:3], dt.Year())
-			}
-		}
-		result.Results = append(result.Results, gore.ResultItem{Data: info})
+	return time.Date(cs.toYear, time.Month(cs.toMonth)+1, 0, 0, 0, 0, 0, time.UTC)
+}
+
+// cacheTTL returns the TTL for the export of the search, treating the output
+// period as current until certIssueMonths after it ends.
+func (cs *CertificateSearch) cacheTTL() time.Duration {
+	end := cs.periodEnd()
+	if end.IsZero() {
+		return certCacheTTL.Current
 	}
-	if len(result.Results) == 0 {
+	return certCacheTTL.For(end.AddDate(0, certIssueMonths, 0))
+}
+
+func (cs *CertificateSearch) GetResults() (result gore.ResultSet) {
+	result.QueryName = "certificatesearch"
+	result.Schema = certSchema
+	result.Query = cs.StreamResults(func(item gore.ResultItem) error {
+		result.Results = append(result.Results, item)
+		return nil
+	})
+	if result.Query.Error == nil && len(result.Results) == 0 {
 		result.Query.Empty = true
 	}
 	return
 }
+
+// StreamResults submits the search and passes each result to fn as it is
+// decoded from the export. Any error returned by fn stops processing.
+func (cs *CertificateSearch) StreamResults(fn func(gore.ResultItem) error) gore.QueryResult {
+	cs.SetCacheTTL(cs.cacheTTL())
+	return cs.StreamDetails("table1.Detail_Collection.Detail", func(detail gore.XmlNode) error {
+		return fn(certificateItem(detail))
+	})
+}
+
+// Stream submits the search and returns a stream of the results as they are
+// decoded from the export.
+func (cs *CertificateSearch) Stream() *gore.ResultStream {
+	return gore.NewResultStream("certificatesearch", certSchema, cs.StreamResults)
+}
+
+func certificateItem(detail gore.XmlNode) gore.ResultItem {
+	info := detail.AttrAsMap(certAttrMap)
+	item := gore.ResultItem{Data: info}
+	certs, ck1 := item.GetInt("NoOfCertificates")
+	perCert, ck2 := item.GetFloat("MWhPerCertificate")
+	info["MWh"] = nil
+	if ck1 && ck2 {
+		info["MWh"] = float64(certs) * perCert
+	}
+	if period, _ := item.GetString("OutputPeriod"); strings.Contains(period, "-") {
+		// Change 01/02/2022 - 28/02/2022 into Feb-2022
+		dtStr := strings.SplitN(period, " - ", 2)[0]
+		dt, err := time.Parse("02/01/2006", dtStr)
+		if err == nil {
+			info["OutputPeriod"] = fmt.Sprintf("%s-%d", dt.Month().String()[:3], dt.Year())
+		}
+	}
+	return item
+}
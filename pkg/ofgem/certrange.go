@@ -0,0 +1,295 @@
+package ofgem
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// certIDRe splits a certificate number into the accreditation number of the
+// station, any letters that follow it, the serial number of the certificate
+// and the output period, given as DDMMYY for the start and end, e.g.
+// G00039NWEN0000000001010420300420.
+var certIDRe = regexp.MustCompile(`^([A-Z]\d{5}[A-Z]{4})([A-Z]*)(\d+)(\d{12})$`)
+
+// certSchemes maps the first letter of an accreditation number to a scheme.
+var certSchemes = map[byte]string{
+	'R': "RO",
+	'G': "REGO",
+}
+
+// CertificateID is a parsed certificate number. Certificates in a range
+// differ only in their Sequence.
+type CertificateID struct {
+	// Scheme is "RO" or "REGO", or empty if it is not known.
+	Scheme string
+	// Station is the accreditation number of the station.
+	Station string
+	// Country is any code that follows the accreditation number.
+	Country string
+	// PeriodStart and PeriodEnd are the output period.
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	// Sequence is the serial number of the certificate.
+	Sequence int
+
+	prefix string
+	suffix string
+	width  int
+}
+
+// ParseCertificateID parses a certificate number such as those given as
+// StartCertificateNo and EndCertificateNo in certificate search results.
+func ParseCertificateID(s string) (CertificateID, error) {
+	parts := certIDRe.FindStringSubmatch(s)
+	if parts == nil {
+		return CertificateID{}, fmt.Errorf("Unable to parse certificate number '%s'", s)
+	}
+	seq, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return CertificateID{}, fmt.Errorf("Unable to parse serial number of certificate number '%s': %w", s, err)
+	}
+	start, err := time.Parse("020106", parts[4][:6])
+	if err != nil {
+		return CertificateID{}, fmt.Errorf("Unable to parse output period of certificate number '%s': %w", s, err)
+	}
+	end, err := time.Parse("020106", parts[4][6:])
+	if err != nil {
+		return CertificateID{}, fmt.Errorf("Unable to parse output period of certificate number '%s': %w", s, err)
+	}
+	return CertificateID{
+		Scheme:      certSchemes[s[0]],
+		Station:     parts[1],
+		Country:     parts[2],
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Sequence:    seq,
+		prefix:      parts[1] + parts[2],
+		suffix:      parts[4],
+		width:       len(parts[3]),
+	}, nil
+}
+
+func (id CertificateID) String() string {
+	return fmt.Sprintf("%s%0*d%s", id.prefix, id.width, id.Sequence, id.suffix)
+}
+
+// SameBatch returns true if the certificates were issued together, so can
+// be part of the same range.
+func (id CertificateID) SameBatch(other CertificateID) bool {
+	return id.batch() == other.batch()
+}
+
+// batch identifies the certificates issued together.
+func (id CertificateID) batch() string {
+	return fmt.Sprintf("%s/%d/%s", id.prefix, id.width, id.suffix)
+}
+
+// withSequence returns the certificate in the same batch with sequence seq.
+func (id CertificateID) withSequence(seq int) CertificateID {
+	id.Sequence = seq
+	return id
+}
+
+// CertificateRange is a range of certificates from the same batch,
+// including both Start and End.
+type CertificateRange struct {
+	Start CertificateID
+	End   CertificateID
+}
+
+// NewCertificateRange parses the first and last certificate numbers of a
+// range.
+func NewCertificateRange(start, end string) (CertificateRange, error) {
+	s, err := ParseCertificateID(start)
+	if err != nil {
+		return CertificateRange{}, err
+	}
+	e, err := ParseCertificateID(end)
+	if err != nil {
+		return CertificateRange{}, err
+	}
+	if !s.SameBatch(e) {
+		return CertificateRange{}, fmt.Errorf("Certificates %s and %s are not from the same batch", start, end)
+	}
+	if e.Sequence < s.Sequence {
+		return CertificateRange{}, fmt.Errorf("Certificate range %s to %s ends before it starts", start, end)
+	}
+	return CertificateRange{s, e}, nil
+}
+
+// ItemCertificateRange returns the range of certificates for a certificate
+// search result.
+func ItemCertificateRange(item gore.ResultItem) (CertificateRange, error) {
+	start, _ := item.GetString("StartCertificateNo")
+	end, _ := item.GetString("EndCertificateNo")
+	return NewCertificateRange(start, end)
+}
+
+func (r CertificateRange) String() string {
+	return r.Start.String() + " - " + r.End.String()
+}
+
+// Count returns the number of certificates in the range.
+func (r CertificateRange) Count() int {
+	return r.End.Sequence - r.Start.Sequence + 1
+}
+
+// CheckCount returns an error if the range does not contain count
+// certificates, e.g. the NoOfCertificates given for it.
+func (r CertificateRange) CheckCount(count int) error {
+	if r.Count() != count {
+		return fmt.Errorf("Certificate range %s contains %d certificates, not %d", r, r.Count(), count)
+	}
+	return nil
+}
+
+// Contains returns true if the certificate is in the range.
+func (r CertificateRange) Contains(id CertificateID) bool {
+	return r.Start.SameBatch(id) && id.Sequence >= r.Start.Sequence && id.Sequence <= r.End.Sequence
+}
+
+// Overlaps returns true if any certificates are in both ranges.
+func (r CertificateRange) Overlaps(other CertificateRange) bool {
+	return r.Start.SameBatch(other.Start) && r.Start.Sequence <= other.End.Sequence && other.Start.Sequence <= r.End.Sequence
+}
+
+// Adjacent returns true if one range follows on directly from the other.
+func (r CertificateRange) Adjacent(other CertificateRange) bool {
+	return r.Start.SameBatch(other.Start) && (r.End.Sequence+1 == other.Start.Sequence || other.End.Sequence+1 == r.Start.Sequence)
+}
+
+// Intersect returns the certificates that are in both ranges.
+func (r CertificateRange) Intersect(other CertificateRange) (CertificateRange, bool) {
+	if !r.Overlaps(other) {
+		return CertificateRange{}, false
+	}
+	start, end := r.Start, r.End
+	if other.Start.Sequence > start.Sequence {
+		start = other.Start
+	}
+	if other.End.Sequence < end.Sequence {
+		end = other.End
+	}
+	return CertificateRange{start, end}, true
+}
+
+// Split splits the range into the certificates before at and those from at
+// onwards. at must be in the range and not the first certificate.
+func (r CertificateRange) Split(at CertificateID) (CertificateRange, CertificateRange, error) {
+	if !r.Contains(at) || at.Sequence == r.Start.Sequence {
+		return CertificateRange{}, CertificateRange{}, fmt.Errorf("Unable to split certificate range %s at %s", r, at)
+	}
+	return CertificateRange{r.Start, at.withSequence(at.Sequence - 1)}, CertificateRange{at, r.End}, nil
+}
+
+// Subtract returns the parts of the range that are not in other.
+func (r CertificateRange) Subtract(other CertificateRange) []CertificateRange {
+	if !r.Overlaps(other) {
+		return []CertificateRange{r}
+	}
+	var parts []CertificateRange
+	if other.Start.Sequence > r.Start.Sequence {
+		parts = append(parts, CertificateRange{r.Start, r.Start.withSequence(other.Start.Sequence - 1)})
+	}
+	if other.End.Sequence < r.End.Sequence {
+		parts = append(parts, CertificateRange{r.End.withSequence(other.End.Sequence + 1), r.End})
+	}
+	return parts
+}
+
+// MergeRanges returns the ranges sorted, with any that overlap or are
+// adjacent merged together.
+func MergeRanges(ranges []CertificateRange) []CertificateRange {
+	sorted := append([]CertificateRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if bi, bj := sorted[i].Start.batch(), sorted[j].Start.batch(); bi != bj {
+			return bi < bj
+		}
+		return sorted[i].Start.Sequence < sorted[j].Start.Sequence
+	})
+	var merged []CertificateRange
+	for _, r := range sorted {
+		if n := len(merged) - 1; n >= 0 && (merged[n].Overlaps(r) || merged[n].Adjacent(r)) {
+			if r.End.Sequence > merged[n].End.Sequence {
+				merged[n].End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// DedupeCertificates removes certificates that appear in more than one of
+// the certificate search results, e.g. when combining snapshots taken at
+// different times. Later items take precedence, so earlier items are
+// trimmed, or split, to the certificates not listed later with their
+// NoOfCertificates and MWh adjusted to match.
+func DedupeCertificates(items []gore.ResultItem) ([]gore.ResultItem, error) {
+	ranges := make([]*CertificateRange, len(items))
+	for n, item := range items {
+		r, err := ItemCertificateRange(item)
+		if err != nil {
+			return nil, err
+		}
+		ranges[n] = &r
+	}
+	return dedupeRanges(items, ranges), nil
+}
+
+// dedupeRanges removes certificates listed more than once, as described for
+// DedupeCertificates, where ranges gives the certificates of each item.
+// Items with a nil range are kept unchanged in their position.
+func dedupeRanges(items []gore.ResultItem, ranges []*CertificateRange) []gore.ResultItem {
+	claimed := make(map[string][]CertificateRange)
+	kept := make([][]gore.ResultItem, len(items))
+	for n := len(items) - 1; n >= 0; n-- {
+		if ranges[n] == nil {
+			kept[n] = []gore.ResultItem{items[n]}
+			continue
+		}
+		r := *ranges[n]
+		parts := []CertificateRange{r}
+		for _, c := range claimed[r.Start.batch()] {
+			var left []CertificateRange
+			for _, part := range parts {
+				left = append(left, part.Subtract(c)...)
+			}
+			parts = left
+		}
+		for _, part := range parts {
+			if part == r {
+				kept[n] = append(kept[n], items[n])
+				continue
+			}
+			kept[n] = append(kept[n], certificatePart(items[n], part))
+		}
+		claimed[r.Start.batch()] = MergeRanges(append(claimed[r.Start.batch()], r))
+	}
+	var deduped []gore.ResultItem
+	for _, k := range kept {
+		deduped = append(deduped, k...)
+	}
+	return deduped
+}
+
+// certificatePart returns a copy of the certificate search result for part
+// of its range.
+func certificatePart(item gore.ResultItem, part CertificateRange) gore.ResultItem {
+	data := make(map[string]interface{}, len(item.Data))
+	for k, v := range item.Data {
+		data[k] = v
+	}
+	data["StartCertificateNo"] = part.Start.String()
+	data["EndCertificateNo"] = part.End.String()
+	data["NoOfCertificates"] = part.Count()
+	if perCert, ck := item.GetFloat("MWhPerCertificate"); ck {
+		data["MWh"] = float64(part.Count()) * perCert
+	}
+	return gore.ResultItem{Data: data}
+}
@@ -0,0 +1,237 @@
+package ofgem
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// cert returns the number of a REGO certificate for April 2020.
+func cert(seq int) string {
+	return fmt.Sprintf("G00039NWEN%010d010420300420", seq)
+}
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func certRange(t *testing.T, start, end int) CertificateRange {
+	t.Helper()
+	r, err := NewCertificateRange(cert(start), cert(end))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func rangeStrings(ranges []CertificateRange) []string {
+	strs := make([]string, len(ranges))
+	for i, r := range ranges {
+		strs[i] = r.String()
+	}
+	return strs
+}
+
+func TestParseCertificateID(t *testing.T) {
+	tests := []struct {
+		number  string
+		scheme  string
+		station string
+		country string
+		seq     int
+		start   time.Time
+		end     time.Time
+	}{
+		{"G00039NWEN0000000001010420300420", "REGO", "G00039NWEN", "", 1, day(2020, time.April, 1), day(2020, time.April, 30)},
+		{"R00001RPSC0000001234010119310119", "RO", "R00001RPSC", "", 1234, day(2019, time.January, 1), day(2019, time.January, 31)},
+		{"R00123RQSCSC00000042010422300922", "RO", "R00123RQSC", "SC", 42, day(2022, time.April, 1), day(2022, time.September, 30)},
+	}
+	for _, tc := range tests {
+		id, err := ParseCertificateID(tc.number)
+		if err != nil {
+			t.Errorf("ParseCertificateID(%s) returned %s", tc.number, err)
+			continue
+		}
+		if id.Scheme != tc.scheme || id.Station != tc.station || id.Country != tc.country || id.Sequence != tc.seq {
+			t.Errorf("ParseCertificateID(%s) = %s %s %s %d, want %s %s %s %d", tc.number, id.Scheme, id.Station, id.Country, id.Sequence, tc.scheme, tc.station, tc.country, tc.seq)
+		}
+		if !id.PeriodStart.Equal(tc.start) || !id.PeriodEnd.Equal(tc.end) {
+			t.Errorf("ParseCertificateID(%s) period = %s - %s, want %s - %s", tc.number, id.PeriodStart, id.PeriodEnd, tc.start, tc.end)
+		}
+		if id.String() != tc.number {
+			t.Errorf("ParseCertificateID(%s).String() = %s", tc.number, id)
+		}
+	}
+
+	for _, number := range []string{
+		"",
+		"G00039NWEN",
+		"G00039NWEN010420300420",
+		"G00039NWEN0000000001320420300420",
+		"G00039NWEN0000000001010420301320",
+		"g00039nwen0000000001010420300420",
+	} {
+		if _, err := ParseCertificateID(number); err == nil {
+			t.Errorf("ParseCertificateID(%s) did not return an error", number)
+		}
+	}
+}
+
+func TestNewCertificateRange(t *testing.T) {
+	r := certRange(t, 11, 20)
+	if r.Count() != 10 {
+		t.Errorf("Count() = %d, want 10", r.Count())
+	}
+	if err := r.CheckCount(10); err != nil {
+		t.Errorf("CheckCount(10) returned %s", err)
+	}
+	if err := r.CheckCount(9); err == nil {
+		t.Error("CheckCount(9) did not return an error")
+	}
+
+	for _, tc := range []struct{ start, end string }{
+		{cert(20), cert(11)},
+		{cert(11), "G00039NWEN0000000020010520310520"},
+		{cert(11), "G00040NWEN0000000020010420300420"},
+		{cert(11), "G00039NWEN00000020010420300420"},
+	} {
+		if _, err := NewCertificateRange(tc.start, tc.end); err == nil {
+			t.Errorf("NewCertificateRange(%s, %s) did not return an error", tc.start, tc.end)
+		}
+	}
+}
+
+func TestCertificateRangeOverlaps(t *testing.T) {
+	other, err := NewCertificateRange("G00039NWEN0000000011010520310520", "G00039NWEN0000000020010520310520")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		a, b     CertificateRange
+		overlaps bool
+		adjacent bool
+	}{
+		{certRange(t, 11, 20), certRange(t, 15, 25), true, false},
+		{certRange(t, 11, 20), certRange(t, 20, 25), true, false},
+		{certRange(t, 11, 20), certRange(t, 12, 13), true, false},
+		{certRange(t, 11, 20), certRange(t, 21, 25), false, true},
+		{certRange(t, 21, 25), certRange(t, 11, 20), false, true},
+		{certRange(t, 11, 20), certRange(t, 22, 25), false, false},
+		// A different output period is a different batch.
+		{certRange(t, 11, 20), other, false, false},
+	}
+	for _, tc := range tests {
+		if got := tc.a.Overlaps(tc.b); got != tc.overlaps {
+			t.Errorf("%s Overlaps %s = %t, want %t", tc.a, tc.b, got, tc.overlaps)
+		}
+		if got := tc.a.Adjacent(tc.b); got != tc.adjacent {
+			t.Errorf("%s Adjacent %s = %t, want %t", tc.a, tc.b, got, tc.adjacent)
+		}
+	}
+}
+
+func TestCertificateRangeSplit(t *testing.T) {
+	r := certRange(t, 11, 20)
+	at, _ := ParseCertificateID(cert(15))
+	before, after, err := r.Split(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != certRange(t, 11, 14) || after != certRange(t, 15, 20) {
+		t.Errorf("Split at 15 = %s and %s", before, after)
+	}
+	for _, seq := range []int{11, 10, 21} {
+		at, _ := ParseCertificateID(cert(seq))
+		if _, _, err := r.Split(at); err == nil {
+			t.Errorf("Split at %d did not return an error", seq)
+		}
+	}
+}
+
+func TestCertificateRangeSubtract(t *testing.T) {
+	r := certRange(t, 11, 20)
+	tests := []struct {
+		other CertificateRange
+		want  []CertificateRange
+	}{
+		{certRange(t, 21, 30), []CertificateRange{r}},
+		{certRange(t, 1, 30), []CertificateRange{}},
+		{certRange(t, 11, 20), []CertificateRange{}},
+		{certRange(t, 1, 12), []CertificateRange{certRange(t, 13, 20)}},
+		{certRange(t, 18, 30), []CertificateRange{certRange(t, 11, 17)}},
+		{certRange(t, 14, 15), []CertificateRange{certRange(t, 11, 13), certRange(t, 16, 20)}},
+	}
+	for _, tc := range tests {
+		got := rangeStrings(r.Subtract(tc.other))
+		if want := rangeStrings(tc.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s Subtract %s = %v, want %v", r, tc.other, got, want)
+		}
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	got := rangeStrings(MergeRanges([]CertificateRange{
+		certRange(t, 31, 40),
+		certRange(t, 1, 10),
+		certRange(t, 11, 15),
+		certRange(t, 14, 20),
+		certRange(t, 50, 50),
+	}))
+	want := rangeStrings([]CertificateRange{certRange(t, 1, 20), certRange(t, 31, 40), certRange(t, 50, 50)})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeRanges = %v, want %v", got, want)
+	}
+}
+
+func certItem(start, end int) gore.ResultItem {
+	count := end - start + 1
+	return gore.ResultItem{Data: map[string]interface{}{
+		"StartCertificateNo": cert(start),
+		"EndCertificateNo":   cert(end),
+		"NoOfCertificates":   count,
+		"MWhPerCertificate":  1.5,
+		"MWh":                1.5 * float64(count),
+		"CertificateStatus":  "Issued",
+	}}
+}
+
+func TestDedupeCertificates(t *testing.T) {
+	later := certItem(14, 15)
+	later.Data["CertificateStatus"] = "Redeemed"
+	deduped, err := DedupeCertificates([]gore.ResultItem{certItem(11, 20), later, certItem(21, 30)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		start, end string
+		count      int
+		mwh        float64
+		status     string
+	}{
+		{cert(11), cert(13), 3, 4.5, "Issued"},
+		{cert(16), cert(20), 5, 7.5, "Issued"},
+		{cert(14), cert(15), 2, 3, "Redeemed"},
+		{cert(21), cert(30), 10, 15, "Issued"},
+	}
+	if len(deduped) != len(want) {
+		t.Fatalf("DedupeCertificates returned %d items, want %d", len(deduped), len(want))
+	}
+	for i, w := range want {
+		item := deduped[i]
+		start, _ := item.GetString("StartCertificateNo")
+		end, _ := item.GetString("EndCertificateNo")
+		count, _ := item.GetInt("NoOfCertificates")
+		mwh, _ := item.GetFloat("MWh")
+		status, _ := item.GetString("CertificateStatus")
+		if start != w.start || end != w.end || count != w.count || mwh != w.mwh || status != w.status {
+			t.Errorf("Item %d = %s - %s %d %g %s, want %s - %s %d %g %s", i, start, end, count, mwh, status, w.start, w.end, w.count, w.mwh, w.status)
+		}
+	}
+
+	if _, err := DedupeCertificates([]gore.ResultItem{{Data: map[string]interface{}{"StartCertificateNo": "bad"}}}); err == nil {
+		t.Error("DedupeCertificates accepted an invalid certificate number")
+	}
+}
@@ -0,0 +1,157 @@
+package ofgem
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// templateTTL is how long the form for a report is reused before it is
+// fetched again, as the session on the Ofgem site expires.
+const templateTTL = 10 * time.Minute
+
+// template is the form for a report page, which searches are given a copy
+// of. ready is closed once the page has been fetched, when form or err is
+// set.
+type template struct {
+	ready   chan struct{}
+	form    *form
+	err     error
+	fetched time.Time
+}
+
+// expired returns true if the template should be fetched again. A template
+// still being fetched has not expired.
+func (t *template) expired() bool {
+	select {
+	case <-t.ready:
+		return t.err != nil || time.Since(t.fetched) > templateTTL
+	default:
+		return false
+	}
+}
+
+// Client holds a session with the Ofgem site that is shared by the searches
+// it creates. Each report page is fetched once and the searches are given a
+// copy of its form, so creating more searches is cheap. The page is fetched
+// again after templateTTL, or once the site rejects the state of a form
+// copied from it. A Client is safe for concurrent use, but each search
+// should only be used by one goroutine at a time.
+type Client struct {
+	client http.Client
+
+	startMu sync.Mutex
+	started bool
+
+	mu        sync.Mutex
+	templates map[string]*template
+}
+
+// NewClient creates a Client with a new session.
+func NewClient() (*Client, error) {
+	client, err := newSession()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{client: client, templates: make(map[string]*template)}, nil
+}
+
+// form returns a copy of the form for uri, fetching the page if there is no
+// current template for it. Searches that need a template being fetched wait
+// for it, but the lock is not held while fetching.
+func (c *Client) form(uri string) (*form, error) {
+	c.mu.Lock()
+	tmpl, ck := c.templates[uri]
+	if ck && !tmpl.expired() {
+		c.mu.Unlock()
+		<-tmpl.ready
+	} else {
+		tmpl = &template{ready: make(chan struct{})}
+		c.templates[uri] = tmpl
+		c.mu.Unlock()
+		tmpl.form, tmpl.err = c.fetchForm(uri)
+		tmpl.fetched = time.Now()
+		close(tmpl.ready)
+	}
+	if tmpl.err != nil {
+		return nil, tmpl.err
+	}
+	f := tmpl.form.clone()
+	f.rejected = func() { c.forget(uri, tmpl) }
+	return f, nil
+}
+
+// forget removes the template for uri, if it is still tmpl, so the page is
+// fetched again for the next search.
+func (c *Client) forget(uri string, tmpl *template) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.templates[uri] == tmpl {
+		delete(c.templates, uri)
+	}
+}
+
+func (c *Client) fetchForm(uri string) (*form, error) {
+	if err := c.startSession(); err != nil {
+		return nil, err
+	}
+	return newForm(uri, c.client)
+}
+
+// startSession gets the report manager page, which starts the session, the
+// first time it is called, so that every report page is fetched using the
+// same session.
+func (c *Client) startSession() error {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+	if c.started {
+		return nil
+	}
+	managerURL, err := MakeUrl("ReportManager.aspx?ReportVisibility=1&ReportCategory=0", true)
+	if err != nil {
+		return err
+	}
+	log.Printf("GET: %s\n", managerURL)
+	resp, err := c.client.Get(managerURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	c.started = true
+	return nil
+}
+
+// NewReport opens the report with the given ReportPath using the session.
+func (c *Client) NewReport(reportPath string) (*Report, error) {
+	return c.openReport(reportPath, "ReportViewer.aspx?ReportPath="+url.QueryEscape(reportPath)+"&ReportVisibility=1")
+}
+
+// NewCertificateSearch creates a certificate search using the session.
+func (c *Client) NewCertificateSearch() (*CertificateSearch, error) {
+	r, err := c.openReport("certificatesearch", "ReportViewer.aspx?ReportPath=/DatawarehouseReports/CertificatesExternalPublicDataWarehouse&ReportVisibility=1&ReportCategory=2")
+	if err != nil {
+		return nil, err
+	}
+	r.SubmitTarget = "ReportViewer$ctl09$Reserved_AsyncLoadTarget"
+	return &CertificateSearch{Report: r}, nil
+}
+
+// NewStationSearch creates a station search using the session.
+func (c *Client) NewStationSearch() (*StationSearch, error) {
+	r, err := c.openReport("stationsearch", "ReportViewer.aspx?ReportPath=/Renewables/Accreditation/AccreditedStationsExternalPublic&ReportVisibility=1&ReportCategory=1")
+	if err != nil {
+		return nil, err
+	}
+	r.SubmitTarget = "ReportViewer$ctl04$ctl00"
+	r.SetCacheTTL(stationCacheTTL)
+	return &StationSearch{Report: r}, nil
+}
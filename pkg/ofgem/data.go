@@ -1,82 +1,102 @@
 package ofgem
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/zathras777/gore/pkg/gore"
 )
 
 var createRe = regexp.MustCompile("\\$create\\(Microsoft.Reporting.WebFormsClient\\._.*ParameterInputControl, .*;")
 var ctlIdListRe = regexp.MustCompile("\"CustomInputControlIdList\":\\[.*\\],")
 var postBackRe = regexp.MustCompile("\"PostBackOnChange\":([a-z]+),")
 
-func (f form) getPostValues() url.Values {
+func (f form) getPostValues() (url.Values, error) {
 	values := url.Values{}
 	for _, inp := range f.inputs {
 		values.Set(inp.id, inp.Value())
 	}
 	for _, sel := range f.selects {
-		values.Set(sel.ID, sel.Value())
+		val, err := sel.Value()
+		if err != nil {
+			return nil, err
+		}
+		values.Set(sel.ID, val)
 	}
 	for _, dd := range f.dropdowns {
 		dd.addPostValues(values)
 	}
-	return values
+	return values, nil
 }
 
-func (f *form) addOrUpdateInput(elem *HTMLElement) {
+func (f *form) addOrUpdateInput(elem *HTMLElement) error {
 	name := elem.Attr("name")
 	if strings.Contains(name, "$ddDropDownButton") || strings.Contains(name, "$txtValue") {
-		return
+		return nil
 	}
 	inp, ck := f.inputs[name]
 	if ck {
 		inp.updateFromHTML(elem)
-		return
+		return nil
 	}
 	if !strings.Contains(name, "$divDropDown") {
 		inp = newInputFromHTML(elem)
 		if inp == nil {
-			return
+			return nil
 		}
 		f.inputs[inp.id] = inp
 		f.types[inp.id] = "Input"
-		return
+		return nil
 	}
 	// It's a dropdown input
-	dd := f.getDropDown(name, true)
+	dd, err := f.getDropDown(name, true)
+	if err != nil {
+		return err
+	}
 	if strings.Contains(name, "$HiddenIndices") {
-		dd.updateSelected(elem.Attr("value"))
+		return dd.updateSelected(elem.Attr("value"))
 	}
+	return nil
 }
 
 func (f *form) addOrUpdateSelect(elem *HTMLElement) {
-	s, ck := f.selects[elem.Attr("name")]
-	if ck {
-		log.Printf("Need to implement updating select %s\n", elem.Attr("name"))
-	} else {
-		s = newSelectFromHTML(elem)
-		f.selects[s.ID] = s
-		f.types[s.ID] = "Select"
-	}
+	// The options available can change after a postback, so always replace
+	// the existing select.
+	s := newSelectFromHTML(elem)
+	f.selects[s.ID] = s
+	f.types[s.ID] = "Select"
 }
 
-func (f *form) recordLabel(elem *HTMLElement) {
+// recordLabel records the label for a field, or for a dropdown option. The
+// options available can change after a postback, so listed holds the
+// dropdowns whose options have been seen in this update and the options from
+// before are removed when the first is seen.
+func (f *form) recordLabel(elem *HTMLElement, listed map[string]bool) error {
 	id := strings.ReplaceAll(elem.Attr("for"), "_", "$")
 	name := strings.ReplaceAll(elem.Text, "\u00a0", " ")
 	if !strings.Contains(id, "$divDropDown") {
 		if strings.Contains("TrueFalseNULL", name) {
-			return
+			return nil
 		}
 		id = strings.ReplaceAll(id, "$txtValue", "")
 		f.labels[name] = id
-		return
+		return nil
+	}
+	dd, err := f.getDropDown(id, false)
+	if err != nil {
+		return err
 	}
-	dd := f.getDropDown(id, false)
-	dd.addOptionLabel(id, name)
+	if !listed[dd.ID] {
+		listed[dd.ID] = true
+		dd.options = make(map[int]string)
+	}
+	return dd.addOptionLabel(id, name)
 }
 
 func (f *form) recordScript(elem *HTMLElement) {
@@ -92,6 +112,18 @@ func (f *form) recordScript(elem *HTMLElement) {
 	}
 }
 
+// recordTotalPages records the number of pages shown in the report toolbar.
+// While the report is being generated this may be an estimate such as "2?",
+// which is recorded as such.
+func (f *form) recordTotalPages(elem *HTMLElement) {
+	text := strings.TrimSpace(elem.Text)
+	num, err := strconv.Atoi(strings.TrimSuffix(text, "?"))
+	if err == nil {
+		f.totalPages = num
+		f.pagesEstimated = strings.HasSuffix(text, "?")
+	}
+}
+
 func (f *form) setPostback(name string, val bool) {
 	if strings.Contains(name, "$ddDropDownButton") {
 		name = dropdownId(name)
@@ -119,18 +151,40 @@ func (f *form) addInput(name, typ, val string) error {
 }
 
 func (f *form) setValueByLabel(lbl, val string) error {
-	id, ck := f.labels[lbl]
+	id, ck := f.findLabel(lbl)
 	if !ck {
-		return fmt.Errorf("Unable to find a label '%s'", lbl)
+		return fmt.Errorf("Unable to find a label '%s': %w", lbl, gore.ErrFormChanged)
 	}
 	return f.setValueById(id, val)
 }
 
-func (f *form) setValueById(id, val string) (err error) {
+// findLabel returns the field ID for the label. If there is no exact match
+// the case, punctuation and spacing of the labels are ignored.
+func (f *form) findLabel(lbl string) (string, bool) {
+	if id, ck := f.labels[lbl]; ck {
+		return id, true
+	}
+	want := normaliseLabel(lbl)
+	for name, id := range f.labels {
+		if normaliseLabel(name) == want {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func normaliseLabel(lbl string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(lbl), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func (f *form) setValueById(id, val string) error {
 	tp, ck := f.types[id]
 	if !ck {
-		return fmt.Errorf("Unable to find a field with ID %s", id)
+		return fmt.Errorf("Unable to find a field with ID %s: %w", id, gore.ErrFormChanged)
 	}
+	var err error
 	switch tp {
 	case "Input":
 		f.inputs[id].value = val
@@ -139,12 +193,68 @@ func (f *form) setValueById(id, val string) (err error) {
 	case "DropDown":
 		err = f.dropdowns[id].setValues(val)
 	}
-	if f.checkPostback(id) == true {
-		return f.doPost(id)
+	if err != nil {
+		return err
+	}
+	return f.changed(id, val)
+}
+
+// updateDropDown calls fn to change the selection of the dropdown labelled
+// lbl, e.g. to select all the options.
+func (f *form) updateDropDown(lbl string, fn func(*dropDown)) error {
+	id, ck := f.findLabel(lbl)
+	if !ck {
+		return fmt.Errorf("Unable to find a label '%s': %w", lbl, gore.ErrFormChanged)
+	}
+	if f.types[id] != "DropDown" {
+		return fmt.Errorf("The field labelled '%s' is not a dropdown", lbl)
+	}
+	dd := f.dropdowns[id]
+	fn(dd)
+	return f.changed(id, dd.getTextValue())
+}
+
+// changed posts the form if changing the field requires the form to be
+// updated.
+func (f *form) changed(id, val string) error {
+	if !f.checkPostback(id) {
+		return nil
+	}
+	err := f.doPost(id)
+	if errors.Is(err, gore.ErrRedirect) {
+		// A field can have more than one label, so use the first in order.
+		var names []string
+		for lbl, lid := range f.labels {
+			if lid == id {
+				names = append(names, lbl)
+			}
+		}
+		name := id
+		if len(names) > 0 {
+			sort.Strings(names)
+			name = names[0]
+		}
+		return fmt.Errorf("Setting %s to '%s' was rejected by the Ofgem site, the combination of values may not be valid: %w", name, val, err)
 	}
 	return err
 }
 
+// fieldValue returns the current value of the field with the given ID. For
+// Selects this is the name of the selected option rather than the value
+// that is posted.
+func (f form) fieldValue(id string) string {
+	switch f.types[id] {
+	case "Input":
+		return f.inputs[id].Value()
+	case "Select":
+		val, _ := f.selects[id].selectedName()
+		return val
+	case "DropDown":
+		return f.dropdowns[id].getTextValue()
+	}
+	return ""
+}
+
 func (f form) Dump() {
 	fmt.Print("\nCurrent Form Data:\n\n")
 	keys := make([]string, 0, len(f.types))
@@ -161,11 +271,15 @@ func (f form) Dump() {
 			}
 			fmt.Printf("Input: %s -> %s\n", nm, val)
 		case "DropDown":
-			dd := f.getDropDown(nm, false)
+			dd, err := f.getDropDown(nm, false)
+			if err != nil {
+				continue
+			}
 			fmt.Printf("DropDown: %s -> %d options listed, %d selected [ %v ]\n", nm, len(dd.options), len(dd.selected), dd.selected)
 			fmt.Println(dd.getTextValue())
 		case "Select":
-			fmt.Printf("Select: %s -> %d options listed -> %s\n", nm, len(f.selects[nm].options), f.selects[nm].Value())
+			val, _ := f.selects[nm].Value()
+			fmt.Printf("Select: %s -> %d options listed -> %s\n", nm, len(f.selects[nm].options), val)
 		}
 	}
 	lbls := make([]string, 0, len(f.labels))
@@ -184,16 +298,16 @@ func (f form) Dump() {
 	fmt.Print("\n\n")
 }
 
-func (fd *form) getDropDown(id string, create bool) *dropDown {
+func (fd *form) getDropDown(id string, create bool) (*dropDown, error) {
 	did := dropdownId(id)
 	dd, ck := fd.dropdowns[did]
 	if !ck {
 		if !create {
-			log.Fatalf("Unable to find a DropDown with an ID of %s", did)
+			return nil, fmt.Errorf("Unable to find a DropDown with an ID of %s: %w", did, gore.ErrFormChanged)
 		}
 		dd = &dropDown{ID: did, options: make(map[int]string)}
 		fd.dropdowns[did] = dd
 		fd.types[did] = "DropDown"
 	}
-	return dd
+	return dd, nil
 }
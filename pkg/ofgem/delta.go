@@ -3,13 +3,14 @@ package ofgem
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/zathras777/gore/pkg/gore"
 )
 
 type deltaInfo struct {
@@ -20,7 +21,6 @@ type deltaInfo struct {
 }
 
 var exportBaseRe = regexp.MustCompile(`\"ExportUrlBase\":\"(.*?)\"`)
-var deltaIter int = 0
 
 func processDelta(resp *http.Response, f *form) error {
 	raw, err := io.ReadAll(resp.Body)
@@ -30,25 +30,36 @@ func processDelta(resp *http.Response, f *form) error {
 	content := string(raw)
 
 	if f.debugDelta == true {
-		ioutil.WriteFile(fmt.Sprintf("delta_%02d.data", deltaIter), raw, 0644)
-		log.Printf("Processing delta response - saved to delta_%02d.data", deltaIter)
-		deltaIter++
+		f.captureContent("delta", raw)
+		log.Printf("Processing delta response of %d bytes", len(raw))
 	}
 
 	var elements []deltaInfo
 	for pos := 0; pos < len(content); {
-		di, used := getNextInfo(string(content[pos:]))
+		di, used, err := getNextInfo(string(content[pos:]))
+		if err != nil {
+			f.captureContent("delta_error", raw)
+			return err
+		}
 		pos += used
 		elements = append(elements, di)
 	}
 
 	if len(elements) == 0 {
-		ioutil.WriteFile("delta_error.data", raw, 0644)
-		return fmt.Errorf("Unable to process the delta response elements. Stored in delta_error.data for review")
+		f.captureContent("delta_error", raw)
+		return fmt.Errorf("%w: Unable to process the delta response elements", gore.ErrParse)
+	}
+
+	// Errors are returned as a single error segment, whose target is the
+	// HTTP status.
+	for _, element := range elements {
+		if element.ct == "error" {
+			return &ServerError{Status: element.tgt, Message: element.content}
+		}
 	}
 
 	if elements[0].ct != "#" {
-		log.Fatal("Incorrect initial delta segment receieved?")
+		return fmt.Errorf("%w: Incorrect initial delta segment receieved?", gore.ErrParse)
 	}
 
 	for n, element := range elements[1:] {
@@ -65,7 +76,13 @@ func processDelta(resp *http.Response, f *form) error {
 			if err != nil {
 				return err
 			}
-			return fmt.Errorf("Received pageRedirect to %s", url)
+			return &gore.RedirectError{URL: url}
+		case "updatePanel":
+			// The parameters shown, and the options available for them, may
+			// have changed.
+			if err := f.parseFragment(element.content); err != nil {
+				return fmt.Errorf("%w: Unable to process updatePanel %s: %s", gore.ErrParse, element.tgt, err)
+			}
 		case "scriptStartupBlock":
 			if strings.Contains(element.content, "ExportUrlBase") {
 				match := exportBaseRe.FindStringSubmatch(element.content)
@@ -80,12 +97,15 @@ func processDelta(resp *http.Response, f *form) error {
 	return nil
 }
 
-func getNextInfo(content string) (deltaInfo, int) {
+func getNextInfo(content string) (deltaInfo, int, error) {
 	di := deltaInfo{}
 	pos := 0
 	loops := []int{0, 1, 2}
 	for i := range loops {
 		idx := strings.Index(content[pos:], "|")
+		if idx == -1 {
+			return di, 0, fmt.Errorf("%w: Unable to find the expected delta separator", gore.ErrParse)
+		}
 		switch i {
 		case 0:
 			sz, _ := strconv.Atoi(content[:idx])
@@ -97,10 +117,16 @@ func getNextInfo(content string) (deltaInfo, int) {
 		}
 		pos += idx + 1
 	}
+	if pos+di.size > len(content) {
+		return di, 0, fmt.Errorf("%w: Delta segment of %d bytes is longer than the remaining content", gore.ErrParse, di.size)
+	}
 	if !strings.HasPrefix(content[pos+di.size:], "|") {
 		xtra := strings.Index(content[pos+di.size:], "|")
+		if xtra == -1 {
+			return di, 0, fmt.Errorf("%w: Unable to find the end of the delta segment", gore.ErrParse)
+		}
 		di.size += xtra
 	}
 	di.content = content[pos : pos+di.size]
-	return di, pos + di.size + 1
+	return di, pos + di.size + 1, nil
 }
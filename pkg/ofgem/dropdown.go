@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -15,29 +16,46 @@ type dropDown struct {
 }
 
 func dropdownId(id string) string {
+	if len(id) < 24 {
+		return id
+	}
 	return id[:24]
 }
 
-func dropdownOptionId(id string) int {
+func dropdownOptionId(id string) (int, error) {
+	if len(id) < 2 {
+		return 0, fmt.Errorf("Unable to get numeric ID from '%s'", id)
+	}
 	did, err := strconv.Atoi(id[len(id)-2:])
 	if err != nil {
-		log.Fatalf("Unable to get numeric ID from %s: %s", id, err)
+		return 0, fmt.Errorf("Unable to get numeric ID from %s: %w", id, err)
 	}
-	return did
+	return did, nil
 }
 
-func (dd *dropDown) addOptionLabel(id, label string) {
-	dd.options[dropdownOptionId(id)] = label
+func (dd *dropDown) addOptionLabel(id, label string) error {
+	did, err := dropdownOptionId(id)
+	if err != nil {
+		return err
+	}
+	dd.options[did] = label
+	return nil
 }
 
-func (dd *dropDown) updateSelected(idlist string) {
+func (dd *dropDown) updateSelected(idlist string) error {
+	var selected []int
 	for _, v := range strings.Split(idlist, ",") {
+		if len(v) == 0 {
+			continue
+		}
 		n, err := strconv.Atoi(v)
 		if err != nil {
-			log.Fatalf("Cannot convert %s into a number: %s", v, err)
+			return fmt.Errorf("Cannot convert %s into a number: %w", v, err)
 		}
-		dd.selected = append(dd.selected, n)
+		selected = append(selected, n)
 	}
+	dd.selected = selected
+	return nil
 }
 
 func (dd dropDown) getTextValue() string {
@@ -56,27 +74,77 @@ func (dd dropDown) selectedAsString() string {
 	return strings.Join(nums, ",")
 }
 
+// selectAllValue is the option SSRS shows to select every option.
+const selectAllValue = "(Select All)"
+
+// setValues selects the options in the comma separated list vals. The case
+// of the options is ignored and "(Select All)" or "*" selects every option.
+// Every value must match an option.
 func (dd *dropDown) setValues(vals string) error {
 	var newopts []int
 	for _, v := range strings.Split(vals, ",") {
-		val := strings.Trim(v, " ")
+		val := strings.TrimSpace(v)
+		if val == "" {
+			continue
+		}
+		if val == "*" || strings.EqualFold(val, selectAllValue) {
+			dd.selectAll()
+			return nil
+		}
+		found := false
 		for opt, name := range dd.options {
-			if name == val {
+			if strings.EqualFold(name, val) && opt >= 2 {
 				newopts = append(newopts, opt-2)
+				found = true
 			}
 		}
+		if !found {
+			return &OptionError{Value: val, Options: dd.optionNames()}
+		}
 	}
 	if len(newopts) == 0 {
-		return fmt.Errorf("Unable to find any options that match '%s' in DropDown", vals)
+		return &OptionError{Value: vals, Options: dd.optionNames()}
 	}
+	sort.Ints(newopts)
 	log.Printf("DropDown: Changing selected from %v to %v", dd.selected, newopts)
 	dd.selected = newopts
 	return nil
 }
 
+// selectAll selects every option.
+func (dd *dropDown) selectAll() {
+	var all []int
+	for opt, name := range dd.options {
+		if opt >= 2 && name != selectAllValue {
+			all = append(all, opt-2)
+		}
+	}
+	sort.Ints(all)
+	dd.selected = all
+}
+
+// clear removes all selections.
+func (dd *dropDown) clear() {
+	dd.selected = nil
+}
+
 func (dd dropDown) addPostValues(values url.Values) {
 	//	log.Printf("POST: %s => %s", dd.ID+"$divDropDown$ctl01$HiddenIndices", dd.selectedAsString())
 	//	log.Printf("POST: %s => '%s'", dd.ID+"$divDropDown$txtValue", dd.getTextValue())
 	values.Set(dd.ID+"$divDropDown$ctl01$HiddenIndices", dd.selectedAsString())
 	values.Set(dd.ID+"$divDropDown$txtValue", dd.getTextValue())
 }
+
+// optionNames returns the labels of the options in order.
+func (dd dropDown) optionNames() []string {
+	nums := make([]int, 0, len(dd.options))
+	for n := range dd.options {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	names := make([]string, len(nums))
+	for i, n := range nums {
+		names[i] = dd.options[n]
+	}
+	return names
+}
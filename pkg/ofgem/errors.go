@@ -0,0 +1,56 @@
+package ofgem
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormError is returned when a search form cannot be created, usually as the
+// Ofgem site could not be reached or returned something unexpected.
+type FormError struct {
+	URL string
+	Err error
+}
+
+func (fe *FormError) Error() string {
+	return fmt.Sprintf("Unable to create a new form instance for URL %s: %s", fe.URL, fe.Err)
+}
+
+func (fe *FormError) Unwrap() error {
+	return fe.Err
+}
+
+// OptionError is returned when a value does not match any of the options
+// available for a select or dropdown. Options lists the valid values.
+type OptionError struct {
+	Value   string
+	Options []string
+}
+
+func (oe *OptionError) Error() string {
+	return fmt.Sprintf("Unable to find any options that match '%s'. Valid options are: %s", oe.Value, strings.Join(oe.Options, ", "))
+}
+
+// ServerError is returned when the Ofgem site reports an error in response
+// to a postback.
+type ServerError struct {
+	Status  string
+	Message string
+}
+
+func (se *ServerError) Error() string {
+	return fmt.Sprintf("The Ofgem site returned an error (%s): %s", se.Status, se.Message)
+}
+
+// StateRejected returns true if the error was caused by the site rejecting
+// the view state or session of the form, so the report page must be fetched
+// again.
+func (se *ServerError) StateRejected() bool {
+	msg := strings.ToLower(se.Message)
+	for _, s := range []string{"viewstate", "view state", "state information", "session"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
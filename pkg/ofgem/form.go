@@ -1,6 +1,7 @@
 package ofgem
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,13 +12,15 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
 )
 
 type form struct {
 	startURL string
 	action   string
 	client   http.Client
-	cookies  *cookiejar.Jar
 
 	inputs        map[string]*input
 	dropdowns     map[string]*dropDown
@@ -28,26 +31,47 @@ type form struct {
 	actionURL     string
 	updateRqd     bool
 	exportUrlBase string
+	// totalPages is the number of pages in the HTML report after it has
+	// been submitted, or 0 if not known. pagesEstimated is set if the site
+	// only gave an estimate. If pageSizeSet is set each page has one row, so
+	// this is also the number of rows.
+	totalPages     int
+	pagesEstimated bool
+	pageSizeSet    bool
+
+	// rejected, if set, is called when the site rejects the state of the
+	// form, e.g. as the session has expired.
+	rejected func()
 
 	debugDelta bool
+	capture    gore.Capturer
+	cache      gore.Cache
+	cacheTTL   time.Duration
 }
 
-func newForm(start string) *form {
+// newSession returns an HTTP client with its own cookie jar, to hold a
+// session with the Ofgem site.
+func newSession() (http.Client, error) {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
-		log.Fatalf("Unable to create a cookie jar??: %s", err)
+		return http.Client{}, fmt.Errorf("Unable to create a cookie jar??: %w", err)
 	}
-
 	// Try and improve performance
 	t := http.DefaultTransport.(*http.Transport).Clone()
 	t.MaxIdleConns = 100
 	t.MaxConnsPerHost = 100
 	t.MaxIdleConnsPerHost = 100
+	return http.Client{Jar: jar, Transport: t}, nil
+}
 
+func newForm(start string, client http.Client) (*form, error) {
+	startURL, err := MakeUrl(start, true)
+	if err != nil {
+		return nil, err
+	}
 	form := &form{
-		startURL: MakeUrl(start, true),
-		client:   http.Client{Jar: jar, Transport: t},
-		cookies:  jar,
+		startURL: startURL,
+		client:   client,
 
 		inputs:    make(map[string]*input),
 		dropdowns: make(map[string]*dropDown),
@@ -57,18 +81,55 @@ func newForm(start string) *form {
 		labels:    make(map[string]string),
 	}
 	if err := form.get(); err != nil {
-		log.Fatalf("Unable to create a new form instance for URL %s\n%v", start, err)
+		return nil, &FormError{URL: startURL, Err: err}
 	}
-	return form
+	return form, nil
 }
 
-func (f *form) get() error {
-	if len(f.cookies.Cookies(baseOfgemURL)) == 0 {
-		if err := f.doGet(MakeUrl("ReportManager.aspx?ReportVisibility=1&ReportCategory=0", true)); err != nil {
-			return err
+// clone returns a copy of the form that can be changed without affecting
+// the original. The HTTP client, and so the session, is shared.
+func (f *form) clone() *form {
+	nf := *f
+	nf.inputs = make(map[string]*input, len(f.inputs))
+	for id, inp := range f.inputs {
+		ni := *inp
+		nf.inputs[id] = &ni
+	}
+	nf.dropdowns = make(map[string]*dropDown, len(f.dropdowns))
+	for id, dd := range f.dropdowns {
+		nd := &dropDown{ID: dd.ID, selected: append([]int(nil), dd.selected...), options: make(map[int]string, len(dd.options))}
+		for n, lbl := range dd.options {
+			nd.options[n] = lbl
+		}
+		nf.dropdowns[id] = nd
+	}
+	nf.selects = make(map[string]*selector, len(f.selects))
+	for id, sel := range f.selects {
+		ns := &selector{ID: sel.ID}
+		for _, opt := range sel.options {
+			no := *opt
+			ns.options = append(ns.options, &no)
 		}
+		nf.selects[id] = ns
 	}
+	nf.types = make(map[string]string, len(f.types))
+	for id, typ := range f.types {
+		nf.types[id] = typ
+	}
+	nf.labels = make(map[string]string, len(f.labels))
+	for lbl, id := range f.labels {
+		nf.labels[lbl] = id
+	}
+	nf.postbacks = make(map[string]bool, len(f.postbacks))
+	for id, pb := range f.postbacks {
+		nf.postbacks[id] = pb
+	}
+	return &nf
+}
 
+// get fetches the report page. The session must already have been started,
+// see Client.startSession.
+func (f *form) get() error {
 	if err := f.doGet(f.startURL); err != nil {
 		return err
 	}
@@ -86,17 +147,67 @@ func (f *form) get() error {
 	return nil
 }
 
+// reportPageSize is the number of rows on each page of the HTML report. With
+// one row per page the number of pages shown is the number of rows in the
+// report, which the export can be checked against.
+const reportPageSize = 1
+
+// Submit submits the form using tgt. If the report has a Page Size it is set
+// to reportPageSize first, so the rows of the report can be counted.
 func (f *form) Submit(tgt string) error {
-	f.setValueByLabel("Page Size", "25")
+	f.totalPages = 0
+	f.pagesEstimated = false
+	_, f.pageSizeSet = f.findLabel("Page Size")
+	if f.pageSizeSet {
+		if err := f.setValueByLabel("Page Size", strconv.Itoa(reportPageSize)); err != nil {
+			f.pageSizeSet = false
+			return fmt.Errorf("Unable to set the page size of the report: %w", err)
+		}
+	}
 	return f.doPost(tgt)
 }
 
+// reportRows returns the number of rows in the HTML report, or 0 if it is
+// not known because the page size was not set or the number of pages is
+// only an estimate.
+func (f form) reportRows() int {
+	if !f.pageSizeSet || f.pagesEstimated {
+		return 0
+	}
+	return f.totalPages * reportPageSize
+}
+
 func (f form) ExportAvailable() bool {
 	return len(f.exportUrlBase) > 0
 }
 
 func (f form) getData(xfmt string) ([]byte, error) {
-	url := MakeUrl(f.exportUrlBase+xfmt, false)
+	key := f.stateKey(xfmt)
+	if f.cache != nil {
+		if content, ck := f.cache.Get(key, f.cacheTTL); ck {
+			return content, nil
+		}
+	}
+	body, err := f.openData(xfmt)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	f.cacheContent(key, content)
+	return content, nil
+}
+
+// openData requests the export in the given format, returning the body of
+// the response so it can be read as it arrives. The caller must close it.
+func (f form) openData(xfmt string) (io.ReadCloser, error) {
+	url, err := MakeUrl(f.exportUrlBase+xfmt, false)
+	if err != nil {
+		return nil, err
+	}
 
 	log.Printf("GET Data: %s\n", url)
 	req, err := http.NewRequest("GET", url, nil)
@@ -107,11 +218,128 @@ func (f form) getData(xfmt string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	content, err := io.ReadAll(resp.Body)
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// exportDetails submits the form using tgt and passes every element found
+// at path in the XML export to fn. If the export for the current form state
+// is cached the form is not submitted. If the number of rows in the HTML
+// report is known and the export has fewer then qr.Capped is set.
+func (f *form) exportDetails(name, tgt, path string, fn func(gore.XmlNode) error) (qr gore.QueryResult) {
+	key := f.stateKey("XML")
+	if f.cache != nil {
+		if rdr, ck := gore.OpenCached(f.cache, key, f.cacheTTL); ck {
+			defer rdr.Close()
+			log.Printf("%s export read from cache", name)
+			qr.Completed = true
+			qr.Error = streamContent(rdr, path, fn)
+			return
+		}
+	}
+	if err := f.Submit(tgt); err != nil {
+		qr.Error = err
+		return
+	}
+	if !f.ExportAvailable() {
+		qr.Error = fmt.Errorf("Unable to retrieve data as no export URL available")
+		return
+	}
+	qr.Completed = true
+	count := 0
+	spool, err := f.streamDetails(name, path, func(node gore.XmlNode) error {
+		count++
+		return fn(node)
+	})
+	if spool != nil {
+		defer spool.Close()
+	}
+	if err != nil {
+		qr.Error = err
+		return
+	}
+	if rows := f.reportRows(); rows > 0 && count < rows {
+		log.Printf("%s export has %d rows but the report has %d", name, count, rows)
+		qr.Capped = true
+		qr.CapLimit = count
+		return
+	}
+	if f.cache != nil {
+		if err := spool.Cache(f.cache, key); err != nil {
+			log.Printf("Unable to cache content: %s", err)
+		}
+	}
+	return
+}
+
+// streamDetails requests the XML export and passes every element found at
+// path to fn as it is decoded. If a capture or cache is set the content of
+// the export is also written to a spool, which is returned so it can be
+// cached once the export is known to be complete. The caller must close it.
+func (f form) streamDetails(name, path string, fn func(gore.XmlNode) error) (*gore.Spool, error) {
+	body, err := f.openData("XML")
 	if err != nil {
 		return nil, err
 	}
-	return content, err
+	defer body.Close()
+
+	var rdr io.Reader = body
+	var spool *gore.Spool
+	if f.capture != nil || f.cache != nil {
+		spool, err = gore.NewSpool()
+		if err != nil {
+			return nil, err
+		}
+		rdr = io.TeeReader(body, spool)
+	}
+	err = streamContent(rdr, path, fn)
+	if f.capture != nil {
+		if err := spool.Capture(f.capture, name); err != nil {
+			log.Printf("Unable to capture %s content: %s", name, err)
+		}
+	}
+	return spool, err
+}
+
+func streamContent(rdr io.Reader, path string, fn func(gore.XmlNode) error) error {
+	stream := gore.NewXMLStream(rdr)
+	stream.Handle(path, fn)
+	return stream.Run()
+}
+
+// stateKey identifies the export for the current form state using the value
+// of every labelled field. Page Size only affects the HTML report, so it is
+// ignored.
+func (f form) stateKey(xfmt string) string {
+	state := url.Values{}
+	for lbl, id := range f.labels {
+		if lbl == "Page Size" {
+			continue
+		}
+		state.Set(lbl, f.fieldValue(id))
+	}
+	return fmt.Sprintf("ofgem/%s/%s?%s", f.startURL, xfmt, state.Encode())
+}
+
+func (f form) cacheContent(key string, content []byte) {
+	if f.cache == nil {
+		return
+	}
+	if err := f.cache.Put(key, content); err != nil {
+		log.Printf("Unable to cache content: %s", err)
+	}
+}
+
+func (f form) captureContent(name string, content []byte) {
+	if f.capture == nil {
+		return
+	}
+	if err := f.capture.Capture(name, content); err != nil {
+		log.Printf("Unable to capture %s content: %s", name, err)
+	}
 }
 
 func (f *form) setValueForLabel(lbl string, val string) error {
@@ -121,6 +349,13 @@ func (f *form) setValueForLabel(lbl string, val string) error {
 	return nil
 }
 
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return &gore.HTTPError{StatusCode: resp.StatusCode, URL: resp.Request.URL.String()}
+	}
+	return nil
+}
+
 func saveResponseBody(resp *http.Response, fn string) error {
 	content, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -161,6 +396,10 @@ func (f *form) doGet(url string) error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
 	if err := f.parseResponse(resp); err != nil {
 		return err
 	}
@@ -173,13 +412,19 @@ func (f *form) doPost(tgt string) error {
 	f.setValueById("__EVENTTARGET", tgt)
 	f.setValueById("ScriptManager1", "ScriptManager1|"+tgt)
 
-	postdata := f.getPostValues()
+	postdata, err := f.getPostValues()
+	if err != nil {
+		return err
+	}
 	//logPostData(postdata)
-	actionUrl := MakeUrl(f.actionURL, true)
+	actionUrl, err := MakeUrl(f.actionURL, true)
+	if err != nil {
+		return err
+	}
 
 	req, err := http.NewRequest("POST", actionUrl, strings.NewReader(postdata.Encode()))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("Content-Length", strconv.Itoa(len(postdata.Encode())))
@@ -196,8 +441,16 @@ func (f *form) doPost(tgt string) error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
 
 	if err := processDelta(resp, f); err != nil {
+		var se *ServerError
+		if errors.As(err, &se) && se.StateRejected() && f.rejected != nil {
+			f.rejected()
+		}
 		return err
 	}
 	return nil
@@ -1,58 +1,31 @@
 package ofgem
 
 import (
-	"log"
+	"fmt"
 	"net/url"
 	"strings"
 )
 
 var (
-	baseOfgemURL   *url.URL
-	publicOfgemURL *url.URL
+	baseOfgemURL, _   = url.Parse("https://renewablesandchp.ofgem.gov.uk")
+	publicOfgemURL, _ = baseOfgemURL.Parse("Public/")
 )
 
-func MakeUrl(uri string, public bool) string {
-	if baseOfgemURL == nil {
-		u, err := url.Parse("https://renewablesandchp.ofgem.gov.uk")
-		if err != nil {
-			log.Fatalf("Unable to parse base Ofgem URL: %s", err)
-		}
-		baseOfgemURL = u
-		u, err = baseOfgemURL.Parse("Public/")
-		if err != nil {
-			log.Fatalf("Unable to create Public URL: %s", err)
-		}
-		publicOfgemURL = u
-	}
+func MakeUrl(uri string, public bool) (string, error) {
 	if strings.HasPrefix(uri, "http") {
-		return uri
-	}
-	if strings.HasPrefix(uri, "/") {
-		var u *url.URL
-		var err error
-		if public {
-			u, err = publicOfgemURL.Parse(uri)
-		} else {
-			u, err = baseOfgemURL.Parse(uri[1:])
-		}
-		if err != nil {
-			log.Fatalf("Unable to makeURL from %s: %s", uri, err)
-		}
-		return u.String()
+		return uri, nil
 	}
-	if uri[:2] == "./" {
-		uri = uri[2:]
+	base := baseOfgemURL
+	if public {
+		base = publicOfgemURL
 	}
-	if public == true {
-		u, err := publicOfgemURL.Parse(uri)
-		if err != nil {
-			log.Fatalf("Unable to makeURL from %s: %s", uri, err)
-		}
-		return u.String()
+	if strings.HasPrefix(uri, "/") && !public {
+		uri = uri[1:]
 	}
-	u, err := baseOfgemURL.Parse(uri)
+	uri = strings.TrimPrefix(uri, "./")
+	u, err := base.Parse(uri)
 	if err != nil {
-		log.Fatalf("Unable to makeURL from %s: %s", uri, err)
+		return "", fmt.Errorf("Unable to makeURL from %s: %w", uri, err)
 	}
-	return u.String()
+	return u.String(), nil
 }
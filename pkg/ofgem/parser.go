@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"golang.org/x/net/html"
@@ -21,39 +22,61 @@ func (f *form) parseResponse(resp *http.Response) error {
 	if err != nil {
 		return err
 	}
-	//	if f.debugDelta == true {
-	//ioutil.WriteFile("response.html", content, 0644)
-	//log.Printf("Response received and stored into response.html")
-	//	}
-	rdr := bytes.NewReader(content)
-	doc, err := goquery.NewDocumentFromReader(rdr)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
 	if err != nil {
 		return err
 	}
-
+	var parseErr error
 	doc.Find("form").Each(func(_ int, s *goquery.Selection) {
 		action, ck := s.Attr("action")
 		if ck {
 			f.actionURL = action
 		}
-		for _, n := range s.Nodes {
-			e := NewHTMLElement(n, s)
-
-			e.ForEach("input", func(elem *HTMLElement) {
-				f.addOrUpdateInput(elem)
-			})
-			e.ForEach("select", func(elem *HTMLElement) {
-				f.addOrUpdateSelect(elem)
-			})
-			e.ForEach("label", func(elem *HTMLElement) {
-				f.recordLabel(elem)
-			})
-			e.ForEach("script", func(elem *HTMLElement) {
-				f.recordScript(elem)
-			})
+		if err := f.parseElements(s); err != nil && parseErr == nil {
+			parseErr = err
 		}
 	})
-	return nil
+	return parseErr
+}
+
+// parseFragment updates the form from part of a page, such as the content
+// of an updatePanel received after a postback.
+func (f *form) parseFragment(content string) error {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return err
+	}
+	return f.parseElements(doc.Selection)
+}
+
+func (f *form) parseElements(s *goquery.Selection) error {
+	var parseErr error
+	keepError := func(err error) {
+		if err != nil && parseErr == nil {
+			parseErr = err
+		}
+	}
+	listed := make(map[string]bool)
+	for _, n := range s.Nodes {
+		e := NewHTMLElement(n, s)
+
+		e.ForEach("input", func(elem *HTMLElement) {
+			keepError(f.addOrUpdateInput(elem))
+		})
+		e.ForEach("select", func(elem *HTMLElement) {
+			f.addOrUpdateSelect(elem)
+		})
+		e.ForEach("label", func(elem *HTMLElement) {
+			keepError(f.recordLabel(elem, listed))
+		})
+		e.ForEach("script", func(elem *HTMLElement) {
+			f.recordScript(elem)
+		})
+		e.ForEach("span[id$='TotalPages']", func(elem *HTMLElement) {
+			f.recordTotalPages(elem)
+		})
+	}
+	return parseErr
 }
 
 func NewHTMLElement(n *html.Node, s *goquery.Selection) *HTMLElement {
@@ -0,0 +1,282 @@
+package ofgem
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// defaultSubmitTarget is the "View Report" button used by most reports.
+const defaultSubmitTarget = "ReportViewer$ctl04$ctl00"
+
+// Report gives access to any of the SSRS reports available from the Ofgem
+// Renewables and CHP register. Parameters are set using the labels shown on
+// the report page and the results are taken from the XML export.
+type Report struct {
+	// Name is used to identify the report in captured and logged output.
+	Name string
+	// SubmitTarget is the form element that submits the report. It is found
+	// automatically, but some reports need a different target.
+	SubmitTarget string
+
+	form *form
+}
+
+// ParameterKind is the type of form element used for a Parameter.
+type ParameterKind string
+
+const (
+	KindInput  ParameterKind = "input"
+	KindSelect ParameterKind = "select"
+	// KindDropDown parameters allow more than one option to be selected.
+	KindDropDown ParameterKind = "dropdown"
+)
+
+var parameterKinds = map[string]ParameterKind{
+	"Input":    KindInput,
+	"Select":   KindSelect,
+	"DropDown": KindDropDown,
+}
+
+// Export formats rendered by the report server.
+const (
+	FormatXML   = "XML"
+	FormatCSV   = "CSV"
+	FormatExcel = "EXCELOPENXML"
+	FormatPDF   = "PDF"
+	FormatWord  = "WORDOPENXML"
+	FormatAtom  = "ATOM"
+)
+
+var exportExtensions = map[string]string{
+	FormatXML:   ".xml",
+	FormatCSV:   ".csv",
+	FormatExcel: ".xlsx",
+	FormatPDF:   ".pdf",
+	FormatWord:  ".docx",
+	FormatAtom:  ".atomsvc",
+}
+
+// ExportFormat returns the export format matching xfmt, ignoring case, and
+// the usual file extension for it.
+func ExportFormat(xfmt string) (string, string, error) {
+	xfmt = strings.ToUpper(xfmt)
+	ext, ck := exportExtensions[xfmt]
+	if !ck {
+		fmts := make([]string, 0, len(exportExtensions))
+		for f := range exportExtensions {
+			fmts = append(fmts, f)
+		}
+		sort.Strings(fmts)
+		return "", "", fmt.Errorf("Unknown export format '%s'. Valid formats are: %s", xfmt, strings.Join(fmts, ", "))
+	}
+	return xfmt, ext, nil
+}
+
+// Parameter describes one of the labelled parameters of a Report.
+type Parameter struct {
+	Label   string
+	ID      string
+	Kind    ParameterKind
+	Options []string
+	// Value is the current value. For selects it is the name of the
+	// selected option, as listed in Options.
+	Value string
+	// Postback is true if setting the parameter causes the form to be
+	// updated, e.g. to change the options available for other parameters.
+	Postback bool
+}
+
+// NewReport opens the report with the given ReportPath, e.g.
+// "/Renewables/Accreditation/AccreditedStationsExternalPublic", using a new
+// session. Use a Client to share a session between reports.
+func NewReport(reportPath string) (*Report, error) {
+	c, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return c.NewReport(reportPath)
+}
+
+func (c *Client) openReport(name, uri string) (*Report, error) {
+	f, err := c.form(uri)
+	if err != nil {
+		return nil, err
+	}
+	f.cacheTTL = gore.DefaultCacheTTL.Current
+	r := &Report{Name: name, SubmitTarget: defaultSubmitTarget, form: f}
+	for id, inp := range f.inputs {
+		if inp.typ == "submit" && inp.value == "View Report" {
+			r.SubmitTarget = id
+		}
+	}
+	return r, nil
+}
+
+// Parameters returns the labelled parameters of the report, sorted by label.
+func (r *Report) Parameters() []Parameter {
+	params := make([]Parameter, 0, len(r.form.labels))
+	for lbl := range r.form.labels {
+		param, _ := r.Parameter(lbl)
+		params = append(params, param)
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Label < params[j].Label })
+	return params
+}
+
+// Parameter returns the parameter with the given label.
+func (r *Report) Parameter(label string) (Parameter, bool) {
+	id, ck := r.form.findLabel(label)
+	if !ck {
+		return Parameter{}, false
+	}
+	param := Parameter{
+		Label:    label,
+		ID:       id,
+		Kind:     parameterKinds[r.form.types[id]],
+		Value:    r.form.fieldValue(id),
+		Postback: r.form.checkPostback(id),
+	}
+	switch param.Kind {
+	case KindSelect:
+		param.Options = r.form.selects[id].optionNames()
+	case KindDropDown:
+		if dd, err := r.form.getDropDown(id, false); err == nil {
+			param.Options = dd.optionNames()
+		}
+	}
+	return param, true
+}
+
+// Set sets the value of the parameter with the given label. The case and
+// punctuation of the label are ignored. For DropDowns value may contain a
+// comma separated list of options, or "*" to select them all.
+func (r *Report) Set(label, value string) error {
+	if _, ck := r.form.findLabel(label); !ck {
+		return fmt.Errorf("Report %s has no parameter labelled '%s': %w", r.Name, label, gore.ErrFormChanged)
+	}
+	return r.form.setValueByLabel(label, value)
+}
+
+// SelectAll selects every option of the dropdown with the given label.
+func (r *Report) SelectAll(label string) error {
+	return r.form.updateDropDown(label, (*dropDown).selectAll)
+}
+
+// ClearSelection removes every selected option from the dropdown with the
+// given label.
+func (r *Report) ClearSelection(label string) error {
+	return r.form.updateDropDown(label, (*dropDown).clear)
+}
+
+// Debug enables capturing of the deltas received after each postback.
+func (r *Report) Debug(onoff bool) {
+	r.form.debugDelta = onoff
+}
+
+// SetCapture passes the raw content of responses received to capture.
+func (r *Report) SetCapture(capture gore.Capturer) {
+	r.form.capture = capture
+}
+
+// SetCache answers requests for an export from cache when possible,
+// storing exports in it.
+func (r *Report) SetCache(cache gore.Cache) {
+	r.form.cache = cache
+}
+
+// SetCacheTTL sets how long cached exports remain valid.
+func (r *Report) SetCacheTTL(ttl time.Duration) {
+	r.form.cacheTTL = ttl
+}
+
+// Submit submits the report using the current parameters, making the export
+// available.
+func (r *Report) Submit() error {
+	if err := r.form.Submit(r.SubmitTarget); err != nil {
+		return err
+	}
+	if !r.form.ExportAvailable() {
+		return fmt.Errorf("Unable to retrieve data for %s as no export URL available", r.Name)
+	}
+	return nil
+}
+
+// Export returns the export of the report in the given format, e.g. XML or
+// CSV. Submit must have been called.
+func (r *Report) Export(xfmt string) ([]byte, error) {
+	xfmt, _, err := ExportFormat(xfmt)
+	if err != nil {
+		return nil, err
+	}
+	if !r.form.ExportAvailable() {
+		return nil, fmt.Errorf("Report %s must be submitted before it can be exported", r.Name)
+	}
+	return r.form.getData(xfmt)
+}
+
+// WriteExport writes the export of the report in the given format to w as
+// it is received, returning the number of bytes written. Submit must have
+// been called.
+func (r *Report) WriteExport(w io.Writer, xfmt string) (int64, error) {
+	xfmt, _, err := ExportFormat(xfmt)
+	if err != nil {
+		return 0, err
+	}
+	if !r.form.ExportAvailable() {
+		return 0, fmt.Errorf("Report %s must be submitted before it can be exported", r.Name)
+	}
+	body, err := r.form.openData(xfmt)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	return io.Copy(w, body)
+}
+
+// SaveExport submits the report and saves the export in the given format
+// to filename. The file is removed if the export fails.
+func (r *Report) SaveExport(filename, xfmt string) (int64, error) {
+	if err := r.Submit(); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.WriteExport(f, xfmt)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return 0, err
+	}
+	return n, nil
+}
+
+// StreamDetails submits the report and passes every element found at path
+// in the XML export to fn, e.g. "table1.Detail_Collection.Detail".
+func (r *Report) StreamDetails(path string, fn func(gore.XmlNode) error) gore.QueryResult {
+	return r.form.exportDetails(r.Name, r.SubmitTarget, path, fn)
+}
+
+// Results submits the report and returns the elements found at path in the
+// XML export, using fieldMap to select the attributes wanted.
+func (r *Report) Results(path string, fieldMap map[string]string) (result gore.ResultSet) {
+	result.QueryName = r.Name
+	result.Schema = gore.NewSchema(fieldMap)
+	result.Query = r.StreamDetails(path, func(detail gore.XmlNode) error {
+		result.Results = append(result.Results, gore.ResultItem{Data: detail.AttrAsMap(fieldMap)})
+		return nil
+	})
+	if result.Query.Error == nil && len(result.Results) == 0 {
+		result.Query.Empty = true
+	}
+	return
+}
@@ -2,7 +2,6 @@ package ofgem
 
 import (
 	"fmt"
-	"log"
 	"strings"
 )
 
@@ -30,14 +29,24 @@ func newSelectFromHTML(elem *HTMLElement) *selector {
 	return s
 }
 
-func (s selector) Value() string {
+func (s selector) Value() (string, error) {
 	for _, opt := range s.options {
 		if opt.selected {
-			return opt.value
+			return opt.value, nil
 		}
 	}
-	log.Fatalf("Unable to find a selected value for %s", s.ID)
-	return ""
+	return "", fmt.Errorf("Unable to find a selected value for %s", s.ID)
+}
+
+// selectedName returns the name of the selected option, which is what is
+// shown on the site and is used to set the selector.
+func (s selector) selectedName() (string, error) {
+	for _, opt := range s.options {
+		if opt.selected {
+			return opt.name, nil
+		}
+	}
+	return "", fmt.Errorf("Unable to find a selected value for %s", s.ID)
 }
 
 func (s *selector) setValue(val string) error {
@@ -53,7 +62,16 @@ func (s *selector) setValue(val string) error {
 		}
 	}
 	if !found {
-		return fmt.Errorf("Unable to find value '%s' in the available options", val)
+		return &OptionError{Value: val, Options: s.optionNames()}
 	}
 	return nil
 }
+
+// optionNames returns the names of the options in order.
+func (s selector) optionNames() []string {
+	names := make([]string, len(s.options))
+	for i, opt := range s.options {
+		names[i] = opt.name
+	}
+	return names
+}
@@ -0,0 +1,286 @@
+package ofgem
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// searchPart configures a search to return one part of its results.
+type searchPart struct {
+	name string
+	set  func() error
+}
+
+// splitter returns the parts a search can be split into and a function to
+// restore the search afterwards. Fewer than 2 parts means the search cannot
+// be split this way.
+type splitter func() ([]searchPart, func() error)
+
+// resultMerger collects the results of the parts of a search, ignoring any
+// results already seen and any without a key. If set, dedupe is used to
+// remove results that overlap once every part has been added.
+type resultMerger struct {
+	result gore.ResultSet
+	seen   map[string]bool
+	key    func(gore.ResultItem) string
+	dedupe func([]gore.ResultItem) []gore.ResultItem
+}
+
+func newResultMerger(name string, schema gore.Schema, key func(gore.ResultItem) string) *resultMerger {
+	return &resultMerger{
+		result: gore.ResultSet{QueryName: name, Schema: schema},
+		seen:   make(map[string]bool),
+		key:    key,
+	}
+}
+
+// newCertificateMerger returns a resultMerger for certificate searches that
+// removes any certificates listed more than once.
+func newCertificateMerger() *resultMerger {
+	m := newResultMerger("certificatesearch", certSchema, certificateRange)
+	m.dedupe = dedupeCertificateResults
+	return m
+}
+
+func (m *resultMerger) fail(err error) {
+	if m.result.Query.Error == nil {
+		m.result.Query.Error = err
+	}
+}
+
+func (m *resultMerger) add(part gore.ResultSet) {
+	if part.Query.Error != nil {
+		m.fail(part.Query.Error)
+		return
+	}
+	m.result.Query.Completed = true
+	if part.Query.Capped {
+		m.result.Query.Capped = true
+	}
+	for _, item := range part.Results {
+		k := m.key(item)
+		if k == "" {
+			log.Printf("%s: ignoring a result with no key", m.result.QueryName)
+			continue
+		}
+		if m.seen[k] {
+			continue
+		}
+		m.seen[k] = true
+		m.result.Results = append(m.result.Results, item)
+	}
+}
+
+// run gets the results using get. If they are incomplete, or the search
+// timed out, the search is split using the first splitter that can and each
+// part is run in the same way. Any other error is recorded without trying
+// to split the search.
+func (m *resultMerger) run(get func() gore.ResultSet, splitters []splitter) {
+	rs := get()
+	if !needsSplit(rs.Query) {
+		m.add(rs)
+		return
+	}
+	for _, split := range splitters {
+		parts, restore := split()
+		if len(parts) < 2 {
+			continue
+		}
+		log.Printf("%s results are incomplete, splitting into %d searches", rs.QueryName, len(parts))
+		for _, part := range parts {
+			log.Printf("%s: searching %s", rs.QueryName, part.name)
+			if err := part.set(); err != nil {
+				m.fail(err)
+				continue
+			}
+			m.run(get, splitters)
+		}
+		if err := restore(); err != nil {
+			m.fail(err)
+		}
+		return
+	}
+	m.add(rs)
+}
+
+// needsSplit returns true if the results of a search are incomplete, or it
+// timed out, so that smaller searches may succeed.
+func needsSplit(qr gore.QueryResult) bool {
+	if qr.Error == nil {
+		return qr.Capped
+	}
+	if errors.Is(qr.Error, context.DeadlineExceeded) {
+		return true
+	}
+	var he *gore.HTTPError
+	if errors.As(qr.Error, &he) {
+		return he.StatusCode == http.StatusGatewayTimeout
+	}
+	var ne net.Error
+	return errors.As(qr.Error, &ne) && ne.Timeout()
+}
+
+// finish returns the merged results. Any results found are returned even
+// if some parts failed, so the caller should check both Query.Error and
+// Query.Capped to see if the results are complete. CapLimit is the number
+// of results returned.
+func (m *resultMerger) finish() gore.ResultSet {
+	if m.dedupe != nil {
+		m.result.Results = m.dedupe(m.result.Results)
+	}
+	if m.result.Query.Error != nil && len(m.result.Results) > 0 {
+		m.result.Query.Capped = true
+	}
+	if m.result.Query.Capped {
+		m.result.Query.CapLimit = len(m.result.Results)
+	}
+	m.result.Query.Empty = m.result.Query.Error == nil && len(m.result.Results) == 0
+	return m.result
+}
+
+// dropDownSplitter splits a search into one search for each option selected
+// in the dropdown labelled lbl.
+func (r *Report) dropDownSplitter(lbl string) splitter {
+	return func() ([]searchPart, func() error) {
+		param, ck := r.Parameter(lbl)
+		if !ck || param.Kind != KindDropDown {
+			return nil, nil
+		}
+		var parts []searchPart
+		for _, opt := range strings.Split(param.Value, ", ") {
+			opt := opt
+			if opt == "" {
+				continue
+			}
+			parts = append(parts, searchPart{lbl + " " + opt, func() error {
+				return r.form.setValueByLabel(lbl, opt)
+			}})
+		}
+		return parts, func() error {
+			return r.form.setValueByLabel(lbl, param.Value)
+		}
+	}
+}
+
+var certPeriodLabels = []string{
+	"Output Period \"Year From\":",
+	"Output Period \"Month From\":",
+	"Output Period \"Year To\":",
+	"Output Period \"Month To\":",
+}
+
+// monthSplitter splits a certificate search into one search for each month
+// of the output periods searched. The periods are read from the names of
+// the selected options, which are also used to restore them.
+func (cs *CertificateSearch) monthSplitter() ([]searchPart, func() error) {
+	var values []string
+	for _, lbl := range certPeriodLabels {
+		param, ck := cs.Parameter(lbl)
+		if !ck {
+			return nil, nil
+		}
+		values = append(values, param.Value)
+	}
+	from, ck1 := periodStart(values[0], values[1], time.January)
+	to, ck2 := periodStart(values[2], values[3], time.December)
+	if !ck1 || !ck2 {
+		return nil, nil
+	}
+	var parts []searchPart
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		month := month
+		parts = append(parts, searchPart{month.Format("January 2006"), func() error {
+			return cs.SetPeriod(int(month.Month()), month.Year())
+		}})
+	}
+	toYear, toMonth := cs.toYear, cs.toMonth
+	return parts, func() error {
+		for i, lbl := range certPeriodLabels {
+			if err := cs.form.setValueByLabel(lbl, values[i]); err != nil {
+				return err
+			}
+		}
+		cs.toYear, cs.toMonth = toYear, toMonth
+		return nil
+	}
+}
+
+// periodStart returns the first day of the month given by the year and
+// month options selected on the form, e.g. "2020" and "Jan". If no month is
+// set dflt is used.
+func periodStart(year, month string, dflt time.Month) (time.Time, bool) {
+	yr, err := strconv.Atoi(strings.TrimSpace(year))
+	if err != nil {
+		return time.Time{}, false
+	}
+	mn := dflt
+	if month = strings.TrimSpace(month); month != "" {
+		dt, err := time.Parse("Jan", month)
+		if err != nil {
+			if dt, err = time.Parse("January", month); err != nil {
+				return time.Time{}, false
+			}
+		}
+		mn = dt.Month()
+	}
+	return time.Date(yr, mn, 1, 0, 0, 0, 0, time.UTC), true
+}
+
+// certificateRange identifies a range of certificates, or is empty if the
+// range is not given.
+func certificateRange(item gore.ResultItem) string {
+	start, _ := item.GetString("StartCertificateNo")
+	end, _ := item.GetString("EndCertificateNo")
+	if start == "" || end == "" {
+		return ""
+	}
+	return start + "-" + end
+}
+
+// dedupeCertificateResults removes certificates that are in more than one
+// result using DedupeCertificates. Results whose certificate numbers can't
+// be parsed are kept as they are, in the same position.
+func dedupeCertificateResults(items []gore.ResultItem) []gore.ResultItem {
+	ranges := make([]*CertificateRange, len(items))
+	for n, item := range items {
+		r, err := ItemCertificateRange(item)
+		if err != nil {
+			log.Printf("Unable to check certificates for duplicates: %s", err)
+			continue
+		}
+		ranges[n] = &r
+	}
+	return dedupeRanges(items, ranges)
+}
+
+// GetAllResults returns every result of the search. If the export for the
+// search is incomplete, or times out, the search is split into one search for
+// each month and then for each scheme and the results merged, removing any
+// certificates found more than once. Query.Capped is set if some results
+// are still missing.
+func (cs *CertificateSearch) GetAllResults() gore.ResultSet {
+	m := newCertificateMerger()
+	m.run(cs.GetResults, []splitter{cs.monthSplitter, cs.dropDownSplitter("Scheme:")})
+	return m.finish()
+}
+
+// GetAllResults returns every result of the search. If the export for the
+// search is incomplete, or times out, the search is split into one search for
+// each scheme and the results merged. Query.Capped is set if some results
+// are still missing.
+func (ss *StationSearch) GetAllResults() gore.ResultSet {
+	m := newResultMerger("stationsearch", stationSchema, func(item gore.ResultItem) string {
+		id, _ := item.GetString("GeneratorID")
+		return id
+	})
+	m.run(ss.GetResults, []splitter{ss.dropDownSplitter("Scheme"), ss.dropDownSplitter("Country")})
+	return m.finish()
+}
@@ -0,0 +1,305 @@
+package ofgem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// testForm returns a form with the output period selectors and a Scheme
+// dropdown of a certificate search. Like the site, the value of each
+// select option is its index rather than its name.
+func testForm() *form {
+	f := &form{
+		inputs:    make(map[string]*input),
+		dropdowns: make(map[string]*dropDown),
+		selects:   make(map[string]*selector),
+		types:     make(map[string]string),
+		labels:    make(map[string]string),
+		postbacks: make(map[string]bool),
+	}
+	years := []string{"2019", "2020", "2021"}
+	var months []string
+	for m := time.January; m <= time.December; m++ {
+		months = append(months, m.String()[:3])
+	}
+	addTestSelect(f, "YearFrom", certPeriodLabels[0], years, "2020")
+	addTestSelect(f, "MonthFrom", certPeriodLabels[1], months, "Nov")
+	addTestSelect(f, "YearTo", certPeriodLabels[2], years, "2021")
+	addTestSelect(f, "MonthTo", certPeriodLabels[3], months, "Feb")
+
+	f.dropdowns["Scheme"] = &dropDown{ID: "Scheme", selected: []int{0, 2}, options: map[int]string{2: "RO", 3: "REGO", 4: "FIT"}}
+	f.types["Scheme"] = "DropDown"
+	f.labels["Scheme:"] = "Scheme"
+	return f
+}
+
+func addTestSelect(f *form, id, lbl string, names []string, selected string) {
+	sel := &selector{ID: id}
+	for i, name := range names {
+		sel.options = append(sel.options, &selectoption{name: name, value: strconv.Itoa(i), selected: name == selected})
+	}
+	f.selects[id] = sel
+	f.types[id] = "Select"
+	f.labels[lbl] = id
+}
+
+func periodValues(f *form) []string {
+	var values []string
+	for _, lbl := range certPeriodLabels {
+		id, _ := f.findLabel(lbl)
+		values = append(values, f.fieldValue(id))
+	}
+	return values
+}
+
+func partNames(parts []searchPart) []string {
+	names := make([]string, len(parts))
+	for i, part := range parts {
+		names[i] = part.name
+	}
+	return names
+}
+
+func TestPeriodStart(t *testing.T) {
+	tests := []struct {
+		year, month string
+		want        time.Time
+		ok          bool
+	}{
+		{"2020", "Nov", day(2020, time.November, 1), true},
+		{"2020", "November", day(2020, time.November, 1), true},
+		{"2020", "", day(2020, time.December, 1), true},
+		{"", "Nov", time.Time{}, false},
+		{"2020", "11", time.Time{}, false},
+	}
+	for _, tc := range tests {
+		got, ok := periodStart(tc.year, tc.month, time.December)
+		if ok != tc.ok || !got.Equal(tc.want) {
+			t.Errorf("periodStart(%s, %s) = %s %t, want %s %t", tc.year, tc.month, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestMonthSplitter(t *testing.T) {
+	cs := &CertificateSearch{Report: &Report{Name: "certificatesearch", form: testForm()}}
+	parts, restore := cs.monthSplitter()
+	want := []string{"November 2020", "December 2020", "January 2021", "February 2021"}
+	if got := partNames(parts); !reflect.DeepEqual(got, want) {
+		t.Fatalf("monthSplitter parts = %v, want %v", got, want)
+	}
+	if err := parts[2].set(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := periodValues(cs.form), []string{"2021", "Jan", "2021", "Jan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("After setting %s the period is %v, want %v", parts[2].name, got, want)
+	}
+	if err := restore(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := periodValues(cs.form), []string{"2020", "Nov", "2021", "Feb"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("After restoring the period is %v, want %v", got, want)
+	}
+}
+
+func TestDropDownSplitter(t *testing.T) {
+	r := &Report{Name: "certificatesearch", form: testForm()}
+	parts, restore := r.dropDownSplitter("Scheme:")()
+	if got, want := partNames(parts), []string{"Scheme: RO", "Scheme: FIT"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("dropDownSplitter parts = %v, want %v", got, want)
+	}
+	if err := parts[1].set(); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.form.fieldValue("Scheme"); got != "FIT" {
+		t.Errorf("After setting %s the scheme is %s", parts[1].name, got)
+	}
+	if err := restore(); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.form.fieldValue("Scheme"); got != "RO, FIT" {
+		t.Errorf("After restoring the scheme is %s", got)
+	}
+
+	if parts, _ := r.dropDownSplitter("Output Period \"Year From\":")(); len(parts) != 0 {
+		t.Errorf("dropDownSplitter split a select into %v", partNames(parts))
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func stationItem(id string) gore.ResultItem {
+	return gore.ResultItem{Data: map[string]interface{}{"GeneratorID": id}}
+}
+
+// schemeSearch returns a get function for a search of the Scheme dropdown
+// of r. A search of more than one scheme fails with fail, while a search of
+// a single scheme returns one result for it.
+func schemeSearch(r *Report, fail gore.QueryResult, calls *int) func() gore.ResultSet {
+	return func() gore.ResultSet {
+		*calls++
+		scheme := r.form.fieldValue("Scheme")
+		if scheme == "RO, FIT" {
+			return gore.ResultSet{QueryName: "stationsearch", Query: fail, Results: []gore.ResultItem{stationItem("RO")}}
+		}
+		return gore.ResultSet{QueryName: "stationsearch", Query: gore.QueryResult{Completed: true}, Results: []gore.ResultItem{stationItem(scheme)}}
+	}
+}
+
+func stationKey(item gore.ResultItem) string {
+	id, _ := item.GetString("GeneratorID")
+	return id
+}
+
+func TestResultMergerRun(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name  string
+		fail  gore.QueryResult
+		calls int
+		ids   []string
+		err   error
+	}{
+		{"capped", gore.QueryResult{Completed: true, Capped: true}, 3, []string{"RO", "FIT"}, nil},
+		{"deadline", gore.QueryResult{Error: context.DeadlineExceeded}, 3, []string{"RO", "FIT"}, nil},
+		{"timeout", gore.QueryResult{Error: fmt.Errorf("Post failed: %w", timeoutError{})}, 3, []string{"RO", "FIT"}, nil},
+		{"gateway timeout", gore.QueryResult{Error: &gore.HTTPError{StatusCode: 504}}, 3, []string{"RO", "FIT"}, nil},
+		{"error", gore.QueryResult{Error: errFailed}, 1, nil, errFailed},
+		{"server error", gore.QueryResult{Error: &gore.HTTPError{StatusCode: 500}}, 1, nil, gore.ErrUpstream},
+	}
+	for _, tc := range tests {
+		r := &Report{Name: "stationsearch", form: testForm()}
+		m := newResultMerger("stationsearch", stationSchema, stationKey)
+		calls := 0
+		m.run(schemeSearch(r, tc.fail, &calls), []splitter{r.dropDownSplitter("Scheme:")})
+		rs := m.finish()
+		if calls != tc.calls {
+			t.Errorf("%s: made %d searches, want %d", tc.name, calls, tc.calls)
+		}
+		var ids []string
+		for _, item := range rs.Results {
+			ids = append(ids, stationKey(item))
+		}
+		if !reflect.DeepEqual(ids, tc.ids) {
+			t.Errorf("%s: results = %v, want %v", tc.name, ids, tc.ids)
+		}
+		if tc.err == nil && rs.Query.Error != nil || tc.err != nil && !errors.Is(rs.Query.Error, tc.err) {
+			t.Errorf("%s: error = %v, want %v", tc.name, rs.Query.Error, tc.err)
+		}
+		if got := r.form.fieldValue("Scheme"); got != "RO, FIT" {
+			t.Errorf("%s: scheme was left as %s", tc.name, got)
+		}
+	}
+}
+
+func TestResultMergerFinish(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name     string
+		parts    []gore.ResultSet
+		count    int
+		capped   bool
+		capLimit int
+		empty    bool
+	}{
+		{"complete", []gore.ResultSet{
+			{Query: gore.QueryResult{Completed: true}, Results: []gore.ResultItem{stationItem("A"), stationItem("B")}},
+			{Query: gore.QueryResult{Completed: true}, Results: []gore.ResultItem{stationItem("B"), stationItem("C"), stationItem("")}},
+		}, 3, false, 0, false},
+		{"capped part", []gore.ResultSet{
+			{Query: gore.QueryResult{Completed: true, Capped: true, CapLimit: 10}, Results: []gore.ResultItem{stationItem("A")}},
+			{Query: gore.QueryResult{Completed: true}, Results: []gore.ResultItem{stationItem("B"), stationItem("C")}},
+		}, 3, true, 3, false},
+		{"failed part", []gore.ResultSet{
+			{Query: gore.QueryResult{Completed: true}, Results: []gore.ResultItem{stationItem("A"), stationItem("B")}},
+			{Query: gore.QueryResult{Error: errFailed}},
+		}, 2, true, 2, false},
+		{"empty", []gore.ResultSet{
+			{Query: gore.QueryResult{Completed: true}},
+		}, 0, false, 0, true},
+	}
+	for _, tc := range tests {
+		m := newResultMerger("stationsearch", stationSchema, stationKey)
+		for _, part := range tc.parts {
+			m.add(part)
+		}
+		rs := m.finish()
+		if rs.Query.Capped != tc.capped || rs.Query.CapLimit != tc.capLimit || rs.Query.Empty != tc.empty {
+			t.Errorf("%s: Capped %t CapLimit %d Empty %t, want %t %d %t", tc.name, rs.Query.Capped, rs.Query.CapLimit, rs.Query.Empty, tc.capped, tc.capLimit, tc.empty)
+		}
+		if len(rs.Results) != tc.count {
+			t.Errorf("%s: returned %d results, want %d", tc.name, len(rs.Results), tc.count)
+		}
+	}
+}
+
+func TestCertificateMerger(t *testing.T) {
+	m := newCertificateMerger()
+	m.add(gore.ResultSet{Query: gore.QueryResult{Completed: true}, Results: []gore.ResultItem{certItem(11, 20)}})
+	m.add(gore.ResultSet{Query: gore.QueryResult{Completed: true}, Results: []gore.ResultItem{certItem(11, 20), certItem(15, 25)}})
+	rs := m.finish()
+	var got []string
+	for _, item := range rs.Results {
+		got = append(got, certificateRange(item))
+	}
+	want := []string{cert(11) + "-" + cert(14), cert(15) + "-" + cert(25)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Merged certificates = %v, want %v", got, want)
+	}
+}
+
+func TestReportRows(t *testing.T) {
+	tests := []struct {
+		pages       string
+		pageSizeSet bool
+		rows        int
+	}{
+		{"12", true, 12},
+		{" 12 ", true, 12},
+		{"12?", true, 0},
+		{"12", false, 0},
+		{"", true, 0},
+	}
+	for _, tc := range tests {
+		f := testForm()
+		f.pageSizeSet = tc.pageSizeSet
+		f.recordTotalPages(&HTMLElement{Text: tc.pages})
+		if got := f.reportRows(); got != tc.rows {
+			t.Errorf("reportRows with %q pages = %d, want %d", tc.pages, got, tc.rows)
+		}
+	}
+}
+
+func TestSubmitPageSize(t *testing.T) {
+	f := testForm()
+	addTestSelect(f, "PageSize", "Page Size", []string{"10", "50"}, "10")
+	if err := f.Submit("Submit"); err == nil {
+		t.Error("Submit did not return the error setting Page Size")
+	}
+	if f.pageSizeSet {
+		t.Error("Submit recorded the page size as set")
+	}
+}
+
+func TestDedupeCertificateResultsKeepsPosition(t *testing.T) {
+	bad := gore.ResultItem{Data: map[string]interface{}{"StartCertificateNo": "bad", "EndCertificateNo": "bad"}}
+	got := dedupeCertificateResults([]gore.ResultItem{certItem(11, 20), bad, certItem(15, 25)})
+	var ranges []string
+	for _, item := range got {
+		ranges = append(ranges, certificateRange(item))
+	}
+	want := []string{cert(11) + "-" + cert(14), "bad-bad", cert(15) + "-" + cert(25)}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("dedupeCertificateResults = %v, want %v", ranges, want)
+	}
+}
@@ -2,14 +2,16 @@ package ofgem
 
 import (
 	"fmt"
-	"io/ioutil"
+	"strconv"
 	"time"
 
 	"github.com/zathras777/gore/pkg/gore"
 )
 
+// StationSearch searches the accredited stations using the Ofgem station
+// report.
 type StationSearch struct {
-	form *form
+	*Report
 }
 
 var stationAttrMap = map[string]string{
@@ -29,12 +31,24 @@ var stationAttrMap = map[string]string{
 	"textbox65:StationAddress":        "string",
 }
 
-func NewStationSearch() *StationSearch {
-	return &StationSearch{
-		form: newForm("ReportViewer.aspx?ReportPath=/Renewables/Accreditation/AccreditedStationsExternalPublic&ReportVisibility=1&ReportCategory=1"),
+var stationSchema = gore.NewSchema(stationAttrMap).WithKey("GeneratorID")
+
+// stationCacheTTL is used for cached exports as stations can be added or
+// change status at any time.
+const stationCacheTTL = 24 * time.Hour
+
+// NewStationSearch creates a station search using a new session. Use a
+// Client to share a session between searches.
+func NewStationSearch() (*StationSearch, error) {
+	c, err := NewClient()
+	if err != nil {
+		return nil, err
 	}
+	return c.NewStationSearch()
 }
 
+// Scheme limits the search to a comma separated list of schemes, or "*"
+// for all schemes.
 func (ss *StationSearch) Scheme(scheme string) error {
 	return ss.form.setValueByLabel("Scheme", scheme)
 }
@@ -55,34 +69,91 @@ func (ss *StationSearch) AccreditationMonth(month int) error {
 	return ss.form.setValueByLabel("Accreditation Month", time.Month(month).String()[:3])
 }
 
-func (ss *StationSearch) GetResults() (result gore.ResultSet) {
-	result.QueryName = "stationsearch"
-	if err := ss.form.Submit("ReportViewer$ctl04$ctl00"); err != nil {
-		result.Query.Error = err
-		return
-	}
-	if !ss.form.ExportAvailable() {
-		result.Query.Error = fmt.Errorf("Unable to retrieve data?")
-		return
-	}
-	data, err := ss.form.getData("XML")
-	if err != nil {
-		result.Query.Error = err
-		return
-	}
-	result.Query.Completed = true
-	ioutil.WriteFile("station_data.xml", data, 0644)
-	xmlData, err := gore.ParseXML(data)
-	if err != nil {
-		result.Query.Error = err
-		return
+// GeneratorName limits the search to stations whose name matches name.
+func (ss *StationSearch) GeneratorName(name string) error {
+	return ss.form.setValueByLabel("Generator Name", name)
+}
+
+// GeneratorID limits the search to the station with the accreditation
+// number id, e.g. "R00001RPSC".
+func (ss *StationSearch) GeneratorID(id string) error {
+	return ss.form.setValueByLabel("Generator ID", id)
+}
+
+// Technologies limits the search to a comma separated list of technologies,
+// e.g. "Off-shore Wind".
+func (ss *StationSearch) Technologies(techs string) error {
+	return ss.form.setValueByLabel("Technology", techs)
+}
+
+// Countries limits the search to a comma separated list of countries.
+func (ss *StationSearch) Countries(countries string) error {
+	return ss.form.setValueByLabel("Country", countries)
+}
+
+// Statuses limits the search to a comma separated list of accreditation
+// statuses, e.g. "Live".
+func (ss *StationSearch) Statuses(statuses string) error {
+	return ss.form.setValueByLabel("Status", statuses)
+}
+
+// MinCapacity limits the search to stations with a capacity of at least min
+// kW.
+func (ss *StationSearch) MinCapacity(min float64) error {
+	return ss.form.setValueByLabel("Capacity From", strconv.FormatFloat(min, 'f', -1, 64))
+}
+
+// MaxCapacity limits the search to stations with a capacity of at most max
+// kW.
+func (ss *StationSearch) MaxCapacity(max float64) error {
+	return ss.form.setValueByLabel("Capacity To", strconv.FormatFloat(max, 'f', -1, 64))
+}
+
+// CapacityRange limits the search to stations with a capacity (in kW)
+// between min and max.
+func (ss *StationSearch) CapacityRange(min, max float64) error {
+	if max < min {
+		return fmt.Errorf("Maximum capacity %g is less than the minimum %g", max, min)
 	}
-	details, err := xmlData.GetAll("tableAccreditation.Detail_Collection.Detail")
-	for _, detail := range details {
-		result.Results = append(result.Results, gore.ResultItem{Data: detail.AttrAsMap(stationAttrMap)})
+	if err := ss.MinCapacity(min); err != nil {
+		return err
 	}
-	if len(result.Results) == 0 {
+	return ss.MaxCapacity(max)
+}
+
+// Organisation limits the search to stations operated by the organisation.
+func (ss *StationSearch) Organisation(org string) error {
+	return ss.form.setValueByLabel("Organisation", org)
+}
+
+// OutputTypes limits the search to a comma separated list of output types.
+func (ss *StationSearch) OutputTypes(types string) error {
+	return ss.form.setValueByLabel("Output Type", types)
+}
+
+func (ss *StationSearch) GetResults() (result gore.ResultSet) {
+	result.QueryName = "stationsearch"
+	result.Schema = stationSchema
+	result.Query = ss.StreamResults(func(item gore.ResultItem) error {
+		result.Results = append(result.Results, item)
+		return nil
+	})
+	if result.Query.Error == nil && len(result.Results) == 0 {
 		result.Query.Empty = true
 	}
 	return
 }
+
+// Stream submits the search and returns a stream of the results as they are
+// decoded from the export.
+func (ss *StationSearch) Stream() *gore.ResultStream {
+	return gore.NewResultStream("stationsearch", stationSchema, ss.StreamResults)
+}
+
+// StreamResults submits the search and passes each result to fn as it is
+// decoded from the export. Any error returned by fn stops processing.
+func (ss *StationSearch) StreamResults(fn func(gore.ResultItem) error) gore.QueryResult {
+	return ss.StreamDetails("tableAccreditation.Detail_Collection.Detail", func(detail gore.XmlNode) error {
+		return fn(gore.ResultItem{Data: detail.AttrAsMap(stationAttrMap)})
+	})
+}
@@ -0,0 +1,256 @@
+// Package store saves results into a local SQLite database, allowing an
+// archive of downloaded data to be kept and queried without using the
+// live APIs.
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+// Store is a SQLite database holding one table per report.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens, or creates, the SQLite database in filename.
+func Open(filename string) (*Store, error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS sync_state (name TEXT PRIMARY KEY, value TEXT)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Unable to open database %s: %w", filename, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (st *Store) Close() error {
+	return st.db.Close()
+}
+
+// DB returns the underlying database, e.g. for running queries.
+func (st *Store) DB() *sql.DB {
+	return st.db
+}
+
+// TableName returns the table used for results of the named query.
+func TableName(queryName string) string {
+	return strings.ToLower(queryName)
+}
+
+// Save saves the results into the table for rs.QueryName, returning the
+// number of rows written.
+func (st *Store) Save(rs gore.ResultSet) (int, error) {
+	return st.SaveTable(TableName(rs.QueryName), rs)
+}
+
+// SaveTable saves the results into table, creating it or adding columns as
+// required. Results whose key fields match an existing row replace the
+// values in that row. If the schema has no key fields, results are always
+// inserted. Key fields can't be null, so if any result lacks a value for one
+// nothing is saved and an error is returned.
+func (st *Store) SaveTable(table string, rs gore.ResultSet) (int, error) {
+	if len(rs.Results) == 0 {
+		return 0, nil
+	}
+	columns := rs.Columns()
+	keys := rs.Schema.Key()
+
+	tx, err := st.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := createTable(tx, table, rs.Schema, columns, keys); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(insertSQL(table, columns, keys))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	types := make([]string, len(columns))
+	for i, col := range columns {
+		if f, ck := rs.Schema.Field(col); ck {
+			types[i] = f.Type
+		}
+	}
+	values := make([]interface{}, len(columns))
+	for n, item := range rs.Results {
+		for _, k := range keys {
+			if missingValue(item.Data[k]) {
+				return 0, fmt.Errorf("Unable to save results to %s: result %d has no value for key field %s", table, n+1, k)
+			}
+		}
+		for i, col := range columns {
+			values[i] = sqlValue(item.Data[col], types[i])
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			return 0, fmt.Errorf("Unable to save results to %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(rs.Results), nil
+}
+
+// SyncState returns the value stored for name, e.g. the last date synced.
+func (st *Store) SyncState(name string) (string, bool, error) {
+	var value string
+	err := st.db.QueryRow(`SELECT value FROM sync_state WHERE name = ?`, name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// SetSyncState stores value for name.
+func (st *Store) SetSyncState(name, value string) error {
+	_, err := st.db.Exec(`INSERT INTO sync_state (name, value) VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET value = excluded.value`, name, value)
+	return err
+}
+
+func createTable(tx *sql.Tx, table string, schema gore.Schema, columns, keys []string) error {
+	isKey := make(map[string]bool)
+	for _, k := range keys {
+		isKey[k] = true
+	}
+	defs := make([]string, len(columns))
+	for i, col := range columns {
+		defs[i] = quote(col) + " " + columnType(schema, col)
+		if isKey[col] {
+			defs[i] += " NOT NULL"
+		}
+	}
+	if len(keys) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+quoteAll(keys)+")")
+	}
+	if _, err := tx.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quote(table), strings.Join(defs, ", "))); err != nil {
+		return fmt.Errorf("Unable to create table %s: %w", table, err)
+	}
+
+	// Fields may have been added since the table was created.
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", quote(table)))
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, col := range columns {
+		if existing[col] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quote(table), quote(col), columnType(schema, col))); err != nil {
+			return fmt.Errorf("Unable to add column %s to %s: %w", col, table, err)
+		}
+	}
+	return nil
+}
+
+func insertSQL(table string, columns, keys []string) string {
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quote(table), quoteAll(columns),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+	if len(keys) == 0 {
+		return query
+	}
+	isKey := make(map[string]bool)
+	for _, k := range keys {
+		isKey[k] = true
+	}
+	var updates []string
+	for _, col := range columns {
+		if !isKey[col] {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", quote(col), quote(col)))
+		}
+	}
+	if len(updates) == 0 {
+		return query + fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", quoteAll(keys))
+	}
+	return query + fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", quoteAll(keys), strings.Join(updates, ", "))
+}
+
+func columnType(schema gore.Schema, name string) string {
+	f, ck := schema.Field(name)
+	if !ck {
+		return "TEXT"
+	}
+	switch f.Type {
+	case "int", "bool":
+		return "INTEGER"
+	case "float":
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+func missingValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	str, ck := v.(string)
+	return ck && str == ""
+}
+
+// sqlValue converts a result value into the value stored. Dates are stored
+// as text so they sort correctly and are readable by other tools.
+func sqlValue(v interface{}, typ string) interface{} {
+	switch val := v.(type) {
+	case time.Time:
+		if typ == "date" {
+			return val.Format("2006-01-02")
+		}
+		return val.UTC().Format(time.RFC3339)
+	case bool:
+		if val {
+			return 1
+		}
+		return 0
+	}
+	return v
+}
+
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
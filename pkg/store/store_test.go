@@ -0,0 +1,152 @@
+package store
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zathras777/gore/pkg/gore"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	st, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+var testSchema = gore.Schema{
+	{Name: "id", Type: "string", Nullable: true},
+	{Name: "day", Type: "date", Nullable: true},
+	{Name: "value", Type: "float", Nullable: true},
+}.WithKey("id", "day")
+
+func testResults(items ...gore.ResultItem) gore.ResultSet {
+	return gore.ResultSet{QueryName: "Test", Schema: testSchema, Results: items}
+}
+
+func testItem(id string, day time.Time, value interface{}) gore.ResultItem {
+	return gore.ResultItem{Data: map[string]interface{}{"id": id, "day": day, "value": value}}
+}
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestSaveUpsert(t *testing.T) {
+	st := openTestStore(t)
+	if _, err := st.Save(testResults(
+		testItem("A", day(2022, time.May, 1), 1.0),
+		testItem("A", day(2022, time.May, 2), 2.0),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := st.Save(testResults(
+		testItem("A", day(2022, time.May, 2), 5.0),
+		testItem("B", day(2022, time.May, 2), nil),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Save returned %d, want 2", n)
+	}
+
+	rows, err := st.DB().Query(`SELECT id, day, value FROM test ORDER BY id, day`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id, dy string
+		var value *float64
+		if err := rows.Scan(&id, &dy, &value); err != nil {
+			t.Fatal(err)
+		}
+		row := id + " " + dy
+		if value == nil {
+			row += " null"
+		} else {
+			row += " " + strconv.FormatFloat(*value, 'f', -1, 64)
+		}
+		got = append(got, row)
+	}
+	want := []string{"A 2022-05-01 1", "A 2022-05-02 5", "B 2022-05-02 null"}
+	if len(got) != len(want) {
+		t.Fatalf("Table has rows %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Row %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSaveRejectsMissingKeys(t *testing.T) {
+	st := openTestStore(t)
+	if _, err := st.Save(testResults(testItem("A", day(2022, time.May, 1), 1.0))); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []gore.ResultItem{
+		testItem("", day(2022, time.May, 1), 1.0),
+		{Data: map[string]interface{}{"id": "A", "day": nil, "value": 1.0}},
+	} {
+		if _, err := st.Save(testResults(testItem("B", day(2022, time.May, 1), 1.0), item)); err == nil {
+			t.Errorf("Save accepted a result with a missing key: %v", item.Data)
+		}
+	}
+	var count int
+	if err := st.DB().QueryRow(`SELECT count(*) FROM test`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Table has %d rows after the saves failed, want 1", count)
+	}
+}
+
+func TestSaveAddsColumns(t *testing.T) {
+	st := openTestStore(t)
+	if _, err := st.Save(testResults(testItem("A", day(2022, time.May, 1), 1.0))); err != nil {
+		t.Fatal(err)
+	}
+	rs := testResults(testItem("A", day(2022, time.May, 1), 2.0))
+	rs.Schema = gore.Schema{
+		{Name: "id", Type: "string", Nullable: true},
+		{Name: "day", Type: "date", Nullable: true},
+		{Name: "value", Type: "float", Nullable: true},
+		{Name: "count", Type: "int", Nullable: true},
+	}.WithKey("id", "day")
+	rs.Results[0].Data["count"] = 3
+	if _, err := st.Save(rs); err != nil {
+		t.Fatal(err)
+	}
+	var value float64
+	var count int
+	if err := st.DB().QueryRow(`SELECT value, count FROM test WHERE id = 'A'`).Scan(&value, &count); err != nil {
+		t.Fatal(err)
+	}
+	if value != 2 || count != 3 {
+		t.Errorf("Row has value %g and count %d, want 2 and 3", value, count)
+	}
+}
+
+func TestSyncState(t *testing.T) {
+	st := openTestStore(t)
+	if _, ck, err := st.SyncState("fuelinst"); err != nil || ck {
+		t.Errorf("SyncState of a new store = %t, %v", ck, err)
+	}
+	for _, value := range []string{"2022-05-01", "2022-05-02"} {
+		if err := st.SetSyncState("fuelinst", value); err != nil {
+			t.Fatal(err)
+		}
+		got, ck, err := st.SyncState("fuelinst")
+		if err != nil || !ck || got != value {
+			t.Errorf("SyncState = %s %t %v, want %s", got, ck, err, value)
+		}
+	}
+}